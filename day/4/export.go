@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+// Size (in pixels) of one grid cell in SVG and PNG exports
+const exportCellSize = 16
+
+// Colours for individual matches, cycled through by match ID
+var matchPalette = []color.RGBA{
+	{0xe6, 0x19, 0x4b, 0xff},
+	{0x3c, 0xb4, 0x4b, 0xff},
+	{0x43, 0x63, 0xd8, 0xff},
+	{0xf5, 0x82, 0x31, 0xff},
+	{0x91, 0x1e, 0xb4, 0xff},
+	{0x42, 0xd4, 0xf4, 0xff},
+	{0xf0, 0x32, 0xe6, 0xff},
+	{0xbf, 0xef, 0x45, 0xff},
+	{0x46, 0x99, 0x90, 0xff},
+	{0x9a, 0x63, 0x24, 0xff},
+}
+
+var (
+	noMatchColour    = color.RGBA{0xee, 0xee, 0xee, 0xff}
+	backgroundColour = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// Writes the grid with every match highlighted, as "ansi", "svg" or "png".
+// By default each match gets its own colour; with heatmap, cells are coloured
+// by how many matches overlap them instead.
+func (g *Grid) Export(w io.Writer, format string, heatmap bool) error {
+	switch format {
+	case "ansi":
+		return g.exportANSI(w, heatmap)
+	case "svg":
+		return g.exportSVG(w, heatmap)
+	case "png":
+		return g.exportPNG(w, heatmap)
+	}
+
+	return fmt.Errorf("unknown export format %q (expected ansi, svg or png)", format)
+}
+
+func (g *Grid) exportANSI(w io.Writer, heatmap bool) error {
+	maxOverlap := g.maxOverlap()
+
+	for _, row := range g.rows() {
+		for _, gn := range row {
+			var err error
+
+			if c, ok := gn.exportColour(heatmap, maxOverlap); ok {
+				_, err = fmt.Fprintf(w, "\x1b[1;38;2;%d;%d;%dm%s\x1b[0m", c.R, c.G, c.B, gn.Value)
+			} else {
+				// Dim anything that isn't part of a match
+				_, err = fmt.Fprintf(w, "\x1b[2m%s\x1b[0m", gn.Value)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprint(w, "\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g *Grid) exportSVG(w io.Writer, heatmap bool) error {
+	maxOverlap := g.maxOverlap()
+	width, height := g.Width*exportCellSize, g.Height*exportCellSize
+
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="monospace" font-size="%d" text-anchor="middle" dominant-baseline="central">`+"\n", width, height, width, height, exportCellSize*3/4)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColour(backgroundColour))
+
+	if err != nil {
+		return err
+	}
+
+	for j, row := range g.rows() {
+		for i, gn := range row {
+			x, y := i*exportCellSize, j*exportCellSize
+			textColour := "#999999"
+
+			if c, ok := gn.exportColour(heatmap, maxOverlap); ok {
+				textColour = "#000000"
+
+				_, err = fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", x, y, exportCellSize, exportCellSize, hexColour(c))
+
+				if err != nil {
+					return err
+				}
+			}
+
+			_, err = fmt.Fprintf(w, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n", x+exportCellSize/2, y+exportCellSize/2, textColour, html.EscapeString(gn.Value))
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = fmt.Fprintln(w, "</svg>")
+
+	return err
+}
+
+// NOTE: the standard library can't draw text, so PNGs only show coloured cells
+func (g *Grid) exportPNG(w io.Writer, heatmap bool) error {
+	maxOverlap := g.maxOverlap()
+	img := image.NewRGBA(image.Rect(0, 0, g.Width*exportCellSize, g.Height*exportCellSize))
+
+	draw.Draw(img, img.Bounds(), &image.Uniform{backgroundColour}, image.Point{}, draw.Src)
+
+	for j, row := range g.rows() {
+		for i, gn := range row {
+			c, _ := gn.exportColour(heatmap, maxOverlap)
+
+			// Leave a 1px gap between cells so neighbouring matches stay distinguishable
+			cell := image.Rect(i*exportCellSize, j*exportCellSize, (i+1)*exportCellSize-1, (j+1)*exportCellSize-1)
+			draw.Draw(img, cell, &image.Uniform{c}, image.Point{}, draw.Src)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// The colour to export a node with, or false if the node isn't in any match
+func (gn *GridNode) exportColour(heatmap bool, maxOverlap int) (color.RGBA, bool) {
+	if len(gn.MatchIDs) == 0 {
+		return noMatchColour, false
+	}
+
+	if heatmap {
+		return heatColour(len(gn.MatchIDs), maxOverlap), true
+	}
+
+	// Where matches overlap, the earliest one wins
+	return matchPalette[gn.MatchIDs[0]%len(matchPalette)], true
+}
+
+// Yellow for cells in a single match, through to red for the most overlapped cells
+func heatColour(overlap int, maxOverlap int) color.RGBA {
+	if maxOverlap <= 1 {
+		return color.RGBA{0xff, 0xd7, 0x00, 0xff}
+	}
+
+	t := float64(overlap-1) / float64(maxOverlap-1)
+
+	return color.RGBA{0xff, uint8(0xd7 * (1 - t)), 0x00, 0xff}
+}
+
+func hexColour(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// The largest number of matches any single node is part of
+func (g *Grid) maxOverlap() int {
+	maxOverlap := 0
+
+	for _, row := range g.rows() {
+		for _, gn := range row {
+			maxOverlap = max(maxOverlap, len(gn.MatchIDs))
+		}
+	}
+
+	return maxOverlap
+}
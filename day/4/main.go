@@ -1,16 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
 )
 
 func main() {
+	exportFormat := flag.String("export", "", "export the grid with matches highlighted, as ansi, svg or png")
+	listMatches := flag.Bool("matches", false, "list every match as row,col,direction")
+	exportPart := flag.Int("part", 1, "which part's matches to export or list (1 or 2)")
+	heatmap := flag.Bool("heatmap", false, "colour exported cells by how many matches overlap them, instead of one colour per match")
+	outPath := flag.String("out", "", "file to write the export to (default stdout)")
+	topology := flag.String("topology", string(Bounded), "how words behave at the edges: bounded, cylinder, torus or wildcard")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines to scan the grid with")
+	flag.Parse()
+
 	text, err := io.ReadAll(os.Stdin)
 
 	if err != nil {
@@ -19,8 +33,19 @@ func main() {
 
 	reader := bytes.NewReader(text)
 
-	grid1 := buildGrid(reader)
-	part1Total := totalForGrid(grid1, 1)
+	grid1, err := buildGrid(reader)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = grid1.SetTopology(Topology(*topology))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	part1Matches := matchesForGrid(grid1, 1, *workers)
 
 	_, err = reader.Seek(0, io.SeekStart)
 
@@ -28,22 +53,91 @@ func main() {
 		log.Fatal(err)
 	}
 
-	grid2 := buildGrid(reader)
-	part2Total := totalForGrid(grid2, 2)
+	grid2, err := buildGrid(reader)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = grid2.SetTopology(Topology(*topology))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	part2Matches := matchesForGrid(grid2, 2, *workers)
+
+	var grid *Grid
+	var matches []Match
+
+	switch *exportPart {
+	case 1:
+		grid, matches = grid1, part1Matches
+	case 2:
+		grid, matches = grid2, part2Matches
+	default:
+		log.Fatalf("-part must be 1 or 2, got %d", *exportPart)
+	}
+
+	if *listMatches {
+		for _, match := range matches {
+			fmt.Printf("%d,%d,%s\n", match.Row, match.Col, match.Direction)
+		}
+
+		return
+	}
+
+	if *exportFormat != "" {
+		err = writeExport(grid, *exportFormat, *heatmap, *outPath)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
 
 	fmt.Println("")
 	fmt.Println("Total (Part 1):")
-	fmt.Println(part1Total)
+	fmt.Println(len(part1Matches))
 
 	fmt.Println("")
 	fmt.Println("Total (Part 2):")
-	fmt.Println(part2Total)
+	fmt.Println(len(part2Matches))
+}
+
+func writeExport(grid *Grid, format string, heatmap bool, outPath string) error {
+	out := os.Stdout
+
+	if outPath != "" {
+		file, err := os.Create(outPath)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		out = file
+	}
+
+	writer := bufio.NewWriter(out)
+
+	err := grid.Export(writer, format, heatmap)
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
 }
 
 var directions []string = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
 
 type Grid struct {
 	FirstNode *GridNode
+	Width     int
+	Height    int
 }
 
 func (g *Grid) First() (*GridNode, error) {
@@ -54,13 +148,59 @@ func (g *Grid) First() (*GridNode, error) {
 	return &GridNode{}, &noNodeError{"grid does not have a first node"}
 }
 
+// Collects the grid's nodes, top to bottom and left to right.
+// This counts cells rather than following links to the edge,
+// since the links wrap around in some topologies.
+func (g *Grid) rows() [][]*GridNode {
+	rows := make([][]*GridNode, 0, g.Height)
+
+	currentLineFirst, err := g.First()
+
+	if err != nil {
+		return rows
+	}
+
+	for j := 0; j < g.Height; j++ {
+		row := make([]*GridNode, 0, g.Width)
+		current := currentLineFirst
+
+		for i := 0; i < g.Width; i++ {
+			row = append(row, current)
+			current = current.EastNode
+		}
+
+		rows = append(rows, row)
+		currentLineFirst = currentLineFirst.SouthNode
+	}
+
+	return rows
+}
+
 type GridNode struct {
 	Value     string
 	NorthNode *GridNode
 	EastNode  *GridNode
 	SouthNode *GridNode
 	WestNode  *GridNode
-	IsInMatch bool
+	Row       int
+	Col       int
+	// Wildcards match any letter (see the "wildcard" topology)
+	IsWildcard bool
+	IsInMatch  bool
+	// IDs of every match this node is part of (a node can be in several)
+	MatchIDs []int
+}
+
+// A single occurrence of the search word
+type Match struct {
+	// Where the match starts (for part 2, the centre of the "X")
+	Row int
+	Col int
+	// Which way the word reads, e.g. "NE"
+	// (for part 2, the directions of both "M"s from the centre, e.g. "NE+NW")
+	Direction string
+	// Every node covered by the match, starting at Row and Col
+	Cells []*GridNode
 }
 
 type noNodeError struct {
@@ -107,12 +247,17 @@ func (gn *GridNode) NeighbourInOppositeDirection(direction string) (*GridNode, e
 	return gn.NeighbourInDirection(oppositeDirection)
 }
 
-func (gn *GridNode) matchesForNodePart1() int {
-	if gn.Value != "X" {
-		return 0
+func (gn *GridNode) MatchesLetter(letter string) bool {
+	return gn.IsWildcard || gn.Value == letter
+}
+
+func (gn *GridNode) matchesForNodePart1() []Match {
+	matches := []Match{}
+
+	if !gn.MatchesLetter("X") {
+		return matches
 	}
 
-	total := 0
 	letters := []string{"M", "A", "S"}
 
 	// If Value is "X",
@@ -129,16 +274,12 @@ func (gn *GridNode) matchesForNodePart1() int {
 		for i := 0; i < len(letters); i++ {
 			testLetter := letters[i]
 
-			if node.Value != testLetter {
+			if !node.MatchesLetter(testLetter) {
 				break
 			} else if i == len(letters)-1 {
 				matchComponents = append(matchComponents, node)
 
-				for _, matchNode := range matchComponents {
-					matchNode.IsInMatch = true
-				}
-
-				total++
+				matches = append(matches, Match{Row: gn.Row, Col: gn.Col, Direction: direction, Cells: matchComponents})
 			} else {
 				nextNode, err := node.NeighbourInDirection(direction)
 
@@ -152,77 +293,58 @@ func (gn *GridNode) matchesForNodePart1() int {
 		}
 	}
 
-	return total
+	return matches
 }
 
-func (gn *GridNode) matchesForNodePart2() int {
-	if gn.Value != "A" {
-		return 0
+func (gn *GridNode) matchesForNodePart2() []Match {
+	matches := []Match{}
+
+	if !gn.MatchesLetter("A") {
+		return matches
 	}
 
-	total := 0
 	directions := []string{"NE", "SE", "SW", "NW"}
+	// Which of the two diagonals (NE-SW and SE-NW) each direction is on
+	diagonals := map[string]int{"NE": 0, "SW": 0, "SE": 1, "NW": 1}
+	// Whether each diagonal reads "MAS" (in either direction)
+	diagonalMatched := [2]bool{}
 	matchCorners := []*GridNode{}
+	// The directions (from this node) of each "M"
+	mDirections := []string{}
 
 	// If Value is "A",
-	// this node might be at the center of a match
+	// this node might be at the center of a match.
+	// Only one direction is recorded per diagonal: a wildcard corner can be both "M" and "S",
+	// so a diagonal might read "MAS" both ways.
 	for _, direction := range directions {
-		for _, match := range matchCorners {
-			oppositeNode, err := gn.NeighbourInOppositeDirection(direction)
-
-			if err != nil {
-				continue
-			}
-
-			// Don't double-count
-			if match == oppositeNode {
-				continue
-			}
-		}
-
-		matchComponents := []*GridNode{}
-
-		node, err := gn.NeighbourInDirection(direction)
-
-		if err != nil {
+		if diagonalMatched[diagonals[direction]] {
 			continue
 		}
 
-		testLetter := "M"
-
-		if node.Value != testLetter {
-			continue
-		}
-
-		matchComponents = append(matchComponents, node)
-
-		node, err = gn.NeighbourInOppositeDirection(direction)
+		mNode, err := gn.NeighbourInDirection(direction)
 
-		if err != nil {
+		if err != nil || !mNode.MatchesLetter("M") {
 			continue
 		}
 
-		testLetter = "S"
+		sNode, err := gn.NeighbourInOppositeDirection(direction)
 
-		if node.Value != testLetter {
+		if err != nil || !sNode.MatchesLetter("S") {
 			continue
 		}
 
-		matchComponents = append(matchComponents, node)
-		matchCorners = append(matchCorners, matchComponents...)
+		diagonalMatched[diagonals[direction]] = true
+		matchCorners = append(matchCorners, mNode, sNode)
+		mDirections = append(mDirections, direction)
 	}
 
-	if len(matchCorners) == 4 {
-		gn.IsInMatch = true
+	if diagonalMatched[0] && diagonalMatched[1] {
+		cells := append([]*GridNode{gn}, matchCorners...)
 
-		for _, matchNode := range matchCorners {
-			matchNode.IsInMatch = true
-		}
-
-		total++
+		matches = append(matches, Match{Row: gn.Row, Col: gn.Col, Direction: strings.Join(mDirections, "+"), Cells: cells})
 	}
 
-	return total
+	return matches
 }
 
 func (gn *GridNode) N() (*GridNode, error) {
@@ -282,13 +404,19 @@ func (gn *GridNode) NW() (*GridNode, error) {
 	return &GridNode{}, &noNodeError{"node does not exist in direction NW"}
 }
 
-func buildGrid(reader *bytes.Reader) *Grid {
+func buildGrid(reader *bytes.Reader) (*Grid, error) {
 	grid := Grid{}
 	var current *GridNode
 	var currentLineFirst *GridNode
 
 	i := 0
 	j := 0
+	blankLines := 0
+
+	// Skip a leading byte order mark, which some Windows editors add
+	if r, _, err := reader.ReadRune(); err == nil && r != byteOrderMark {
+		_ = reader.UnreadRune()
+	}
 
 	// Build the grid left to right, top to bottom
 	for {
@@ -297,33 +425,55 @@ func buildGrid(reader *bytes.Reader) *Grid {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading standard input\n")
-			os.Exit(1)
+			return nil, fmt.Errorf("error reading input: %w", err)
 		}
 
 		if isLineTerminator(r) {
+			if r == '\r' {
+				// Treat "\r\n" (Windows line endings) as a single line terminator
+				if next, _, err := reader.ReadRune(); err == nil && next != '\n' {
+					_ = reader.UnreadRune()
+				}
+			}
+
+			if i == 0 {
+				// Blank lines are only allowed at the end of the input
+				blankLines++
+				continue
+			}
+
+			err := grid.endRow(j, i)
+
+			if err != nil {
+				return nil, err
+			}
+
 			// Start a new line
 			i = 0
 			j++
 			continue
 		}
 
+		if blankLines > 0 {
+			return nil, fmt.Errorf("row %d is blank", j+1)
+		}
+
 		char := string(r)
 
 		if i == 0 {
 			if j == 0 {
-				newNode := GridNode{Value: char}
+				newNode := GridNode{Value: char, Row: j, Col: i}
 				current = &newNode
 				grid.FirstNode = current
 			} else {
-				newNode := GridNode{Value: char, NorthNode: currentLineFirst}
+				newNode := GridNode{Value: char, Row: j, Col: i, NorthNode: currentLineFirst}
 				current = &newNode
 				currentLineFirst.SouthNode = current
 			}
 
 			currentLineFirst = current
 		} else {
-			newNode := GridNode{Value: char, WestNode: current}
+			newNode := GridNode{Value: char, Row: j, Col: i, WestNode: current}
 
 			north, err := current.NE()
 
@@ -341,49 +491,100 @@ func buildGrid(reader *bytes.Reader) *Grid {
 		i++
 	}
 
-	return &grid
+	if i > 0 {
+		// The last line didn't have a line terminator
+		err := grid.endRow(j, i)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &grid, nil
 }
 
-func totalForGrid(grid *Grid, part int) int {
-	total := 0
+// Records the width of the first row, and checks that every other row matches it
+func (g *Grid) endRow(row int, width int) error {
+	if row == 0 {
+		g.Width = width
+	} else if width != g.Width {
+		return fmt.Errorf("row %d has %d cells, but row 1 has %d", row+1, width, g.Width)
+	}
 
-	first, err := grid.First()
+	g.Height = row + 1
 
-	if err != nil {
+	return nil
+}
+
+// Finds every match in the grid, and marks the nodes that are part of each one.
+// A match's ID (in each node's MatchIDs) is its index in the result.
+//
+// Rows are scanned concurrently by a pool of workers. Scanning only reads the grid,
+// and matches are collected per row, so the result is the same for any number of workers.
+func matchesForGrid(grid *Grid, part int, workers int) []Match {
+	if _, err := grid.First(); err != nil {
 		fmt.Fprintf(os.Stderr, "grid is empty")
 		os.Exit(1)
 	}
 
-	current, currentLineFirst := first, first
+	rows := grid.rows()
+	rowMatches := make([][]Match, len(rows))
+	rowIndexes := make(chan int)
 
-	for {
-		if part == 1 {
-			total += current.matchesForNodePart1()
-		} else if part == 2 {
-			total += current.matchesForNodePart2()
-		}
+	var wg sync.WaitGroup
 
-		east, err := current.E()
+	for range max(workers, 1) {
+		wg.Add(1)
 
-		if err == nil {
-			// There's an east, keep going east on this line
-			current = east
-		} else {
-			// There's no east, go to the next line
-			nextLineFirst, err := currentLineFirst.S()
+		go func() {
+			defer wg.Done()
 
-			if err != nil {
-				break
+			for j := range rowIndexes {
+				rowMatches[j] = matchesForRow(rows[j], part)
 			}
+		}()
+	}
+
+	for j := range rows {
+		rowIndexes <- j
+	}
+
+	close(rowIndexes)
+	wg.Wait()
+
+	matches := []Match{}
+
+	for _, m := range rowMatches {
+		matches = append(matches, m...)
+	}
+
+	// Only mark the nodes once all the workers are done with the grid
+	for id, match := range matches {
+		for _, matchNode := range match.Cells {
+			matchNode.IsInMatch = true
+			matchNode.MatchIDs = append(matchNode.MatchIDs, id)
+		}
+	}
+
+	return matches
+}
+
+func matchesForRow(row []*GridNode, part int) []Match {
+	matches := []Match{}
 
-			currentLineFirst = nextLineFirst
-			current = nextLineFirst
+	for _, current := range row {
+		if part == 1 {
+			matches = append(matches, current.matchesForNodePart1()...)
+		} else if part == 2 {
+			matches = append(matches, current.matchesForNodePart2()...)
 		}
 	}
 
-	return total
+	return matches
 }
 
+const byteOrderMark = '\uFEFF'
+
 func isLineTerminator(r rune) bool {
 	switch r {
 	case '\u000a', '\u000d', '\u2028', '\u2029':
@@ -394,40 +595,22 @@ func isLineTerminator(r rune) bool {
 
 // debugging util
 func (g *Grid) Print(onlyMatches bool) {
-	first, err := g.First()
-
-	if err != nil {
+	if _, err := g.First(); err != nil {
 		fmt.Fprintf(os.Stderr, "grid is empty")
 		os.Exit(1)
 	}
 
-	current, currentLineFirst := first, first
-
-	for {
-		if onlyMatches && !current.IsInMatch {
-			fmt.Print(".")
-		} else {
-			fmt.Print(current.Value)
-		}
-
-		east, err := current.E()
-
-		if err == nil {
-			// There's an east, keep going east on this line
-			current = east
-		} else {
-			// There's no east, go to the next line
-			fmt.Print("\n")
-
-			nextLineFirst, err := currentLineFirst.S()
-
-			if err != nil {
-				break
+	// Walk the rows rather than following East/South links, which may wrap around
+	for _, row := range g.rows() {
+		for _, current := range row {
+			if onlyMatches && !current.IsInMatch {
+				fmt.Print(".")
+			} else {
+				fmt.Print(current.Value)
 			}
-
-			currentLineFirst = nextLineFirst
-			current = nextLineFirst
 		}
+
+		fmt.Print("\n")
 	}
 
 	fmt.Print("\n")
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// A fresh grid for each scan, since scanning marks the nodes that are in matches
+func gridForFile(t testing.TB, name string, topology Topology) *Grid {
+	t.Helper()
+
+	text, err := os.ReadFile(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid, err := buildGrid(bytes.NewReader(text))
+
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+
+	err = grid.SetTopology(topology)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return grid
+}
+
+// Each match as "row,col,direction: cells", so matches from different grids can be compared
+func formatMatches(matches []Match) []string {
+	formatted := make([]string, 0, len(matches))
+
+	for _, match := range matches {
+		cells := make([]string, 0, len(match.Cells))
+
+		for _, cell := range match.Cells {
+			cells = append(cells, fmt.Sprintf("%d,%d", cell.Row, cell.Col))
+		}
+
+		formatted = append(formatted, fmt.Sprintf("%d,%d,%v: %v", match.Row, match.Col, match.Direction, cells))
+	}
+
+	return formatted
+}
+
+// The workers share the grid, so run this with -race
+func TestMatchesForGridWorkers(t *testing.T) {
+	for _, topology := range []Topology{Bounded, Cylinder, Torus, Wildcard} {
+		for _, part := range []int{1, 2} {
+			t.Run(fmt.Sprintf("%v/part%d", topology, part), func(t *testing.T) {
+				want := formatMatches(matchesForGrid(gridForFile(t, "input.txt", topology), part, 1))
+
+				for _, workers := range []int{2, 8} {
+					got := formatMatches(matchesForGrid(gridForFile(t, "input.txt", topology), part, workers))
+
+					if !slices.Equal(got, want) {
+						t.Errorf("%d workers: got %d matches, want the same %d as 1 worker", workers, len(got), len(want))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestMatchesForGrid(t *testing.T) {
+	tests := []struct {
+		file string
+		part int
+		want int
+	}{
+		{"test1.txt", 1, 18},
+		{"test1.txt", 2, 9},
+		{"input.txt", 1, 2358},
+		{"input.txt", 2, 1737},
+	}
+
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v/part%d", test.file, test.part), func(t *testing.T) {
+			got := len(matchesForGrid(gridForFile(t, test.file, Bounded), test.part, 4))
+
+			if got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBuildGrid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// The grid's rows, if it builds
+		want []string
+		// Part of the error, if it doesn't
+		wantErr string
+	}{
+		{"line feeds", "XM\nAS\n", []string{"XM", "AS"}, ""},
+		{"no final line terminator", "XM\nAS", []string{"XM", "AS"}, ""},
+		{"windows line endings", "XM\r\nAS\r\n", []string{"XM", "AS"}, ""},
+		{"byte order mark", "\ufeffXM\nAS\n", []string{"XM", "AS"}, ""},
+		{"trailing blank lines", "XM\nAS\n\n\r\n", []string{"XM", "AS"}, ""},
+		{"blank line between rows", "XM\n\nAS\n", nil, "row 2 is blank"},
+		{"blank line between windows rows", "XM\r\n\r\nAS\r\n", nil, "row 2 is blank"},
+		{"short row", "XMA\nAS\nXMA\n", nil, "row 2 has 2 cells, but row 1 has 3"},
+		{"long row", "XM\nAS\nXMA\n", nil, "row 3 has 3 cells, but row 1 has 2"},
+		{"short last row", "XM\nA", nil, "row 2 has 1 cells, but row 1 has 2"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := buildGrid(bytes.NewReader([]byte(test.text)))
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, grid.Height)
+
+			for _, row := range grid.rows() {
+				text := ""
+
+				for _, node := range row {
+					text += node.Value
+				}
+
+				got = append(got, text)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got rows %q, want %q", got, test.want)
+			}
+
+			if grid.Width != len(test.want[0]) || grid.Height != len(test.want) {
+				t.Errorf("got %dx%d, want %dx%d", grid.Width, grid.Height, len(test.want[0]), len(test.want))
+			}
+		})
+	}
+}
+
+func gridForText(t testing.TB, text string, topology Topology) (*Grid, error) {
+	t.Helper()
+
+	grid, err := buildGrid(bytes.NewReader([]byte(text)))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return grid, grid.SetTopology(topology)
+}
+
+func TestMatchesForGridTopologies(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		topology Topology
+		part     int
+		want     int
+	}{
+		// The cells along the edge match any letter, so the "X" is on the west edge.
+		// The top and bottom rows are all edge, and each spells "XMAS" twice forwards and twice backwards.
+		{"wildcard edge", ".....\n.MAS.\n.....\n", Wildcard, 1, 9},
+		{"bounded edge", ".....\n.MAS.\n.....\n", Bounded, 1, 0},
+		// Wraps from the east edge to the west edge
+		{"cylinder row", "ASXM\n", Cylinder, 1, 1},
+		{"bounded row", "ASXM\n", Bounded, 1, 0},
+		// Wraps from the south edge to the north edge
+		{"torus column", "A...\nS...\nX...\nM...\n", Torus, 1, 1},
+		{"cylinder column", "A...\nS...\nX...\nM...\n", Cylinder, 1, 0},
+		{"bounded X", "M.S\n.A.\nM.S\n", Bounded, 2, 1},
+		// Wildcard corners could be "M" or "S", which mustn't stop the "X" matching
+		{"wildcard X", "M.S\n.A.\nM.S\n", Wildcard, 2, 1},
+		{"wildcard corners", "...\n.A.\n...\n", Wildcard, 2, 1},
+		{"bounded corners", "...\n.A.\n...\n", Bounded, 2, 0},
+		// The "A" is on the west edge, and its west corners wrap to the east edge
+		{"cylinder X", ".M.M\nA...\n.S.S\n", Cylinder, 2, 1},
+		{"bounded cut-off X", ".M.M\nA...\n.S.S\n", Bounded, 2, 0},
+		// The "A" is in the north west corner, and its corners wrap on both axes
+		{"torus X", ".A..\nS.S.\n....\nM.M.\n", Torus, 2, 1},
+		{"cylinder cut-off X", ".A..\nS.S.\n....\nM.M.\n", Cylinder, 2, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := gridForText(t, test.text, test.topology)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := len(matchesForGrid(grid, test.part, 1))
+
+			if got != test.want {
+				t.Errorf("part %d with %v: got %d, want %d", test.part, test.topology, got, test.want)
+			}
+		})
+	}
+}
+
+// On a grid smaller than a word, a wrapped word could run back over its own cells
+func TestSetTopologyTooSmall(t *testing.T) {
+	tests := []struct {
+		text     string
+		topology Topology
+	}{
+		{"XMAS\n", Torus},
+		{"XMA\nXMA\nXMA\nXMA\n", Cylinder},
+		{"XMA\nXMA\nXMA\nXMA\n", Torus},
+	}
+
+	for _, test := range tests {
+		if _, err := gridForText(t, test.text, test.topology); err == nil {
+			t.Errorf("%v on %q: expected an error", test.topology, test.text)
+		}
+	}
+}
+
+func BenchmarkMatchesForGrid(b *testing.B) {
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for range b.N {
+				b.StopTimer()
+				grid := gridForFile(b, "input.txt", Bounded)
+				b.StartTimer()
+
+				matchesForGrid(grid, 1, workers)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import "fmt"
+
+// How the edges of the grid behave during the word search
+type Topology string
+
+const (
+	// Words stop at the edges (the original puzzle)
+	Bounded Topology = "bounded"
+	// Words wrap around from the east edge to the west edge, and vice versa
+	Cylinder Topology = "cylinder"
+	// Words wrap around on both axes
+	Torus Topology = "torus"
+	// Words stop at the edges, but the cells along the edges match any letter
+	Wildcard Topology = "wildcard"
+)
+
+// How wide (or tall) the grid must be to wrap words around it. Any smaller, and a word could wrap
+// back onto its own cells, so the same cells would be found again in other directions.
+const minimumWrapSize = len("XMAS")
+
+// Links (or marks) the grid's edge nodes according to the topology.
+// This should be called once, straight after building the grid.
+func (g *Grid) SetTopology(topology Topology) error {
+	rows := g.rows()
+
+	if (topology == Cylinder || topology == Torus) && g.Width < minimumWrapSize {
+		return fmt.Errorf("the grid must be at least %d cells wide for the %v topology, but it's %d", minimumWrapSize, topology, g.Width)
+	}
+
+	if topology == Torus && g.Height < minimumWrapSize {
+		return fmt.Errorf("the grid must be at least %d cells tall for the %v topology, but it's %d", minimumWrapSize, topology, g.Height)
+	}
+
+	switch topology {
+	case Bounded:
+		// Nothing to do, buildGrid leaves the edges unlinked
+	case Cylinder:
+		wrapEastWest(rows)
+	case Torus:
+		wrapEastWest(rows)
+		wrapNorthSouth(rows)
+	case Wildcard:
+		for j, row := range rows {
+			for i, gn := range row {
+				if j == 0 || j == g.Height-1 || i == 0 || i == g.Width-1 {
+					gn.IsWildcard = true
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unknown topology %q (expected bounded, cylinder, torus or wildcard)", topology)
+	}
+
+	return nil
+}
+
+func wrapEastWest(rows [][]*GridNode) {
+	for _, row := range rows {
+		first, last := row[0], row[len(row)-1]
+
+		first.WestNode = last
+		last.EastNode = first
+	}
+}
+
+func wrapNorthSouth(rows [][]*GridNode) {
+	if len(rows) == 0 {
+		return
+	}
+
+	top, bottom := rows[0], rows[len(rows)-1]
+
+	for i := range top {
+		top[i].NorthNode = bottom[i]
+		bottom[i].SouthNode = top[i]
+	}
+}
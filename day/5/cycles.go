@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// What to do with an invalid update whose rules contain a cycle,
+// since there's no order of its pages that satisfies every rule
+type CyclePolicy string
+
+const (
+	// Leave the update out of the fixed pages
+	SkipCycles CyclePolicy = "skip"
+	// Keep the update, in the best order sortPages could find
+	FlagCycles CyclePolicy = "flag"
+)
+
+func parseCyclePolicy(s string) (CyclePolicy, error) {
+	switch policy := CyclePolicy(s); policy {
+	case SkipCycles, FlagCycles:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown cycle policy %q (expected skip or flag)", s)
+}
+
+// Finds a cycle in the rules between the given pages, e.g. [13, 29, 47, 13],
+// or returns nil if there isn't one.
+// If rules is a transitive closure, the cycle is made of the direct rules it was built from,
+// so it can pass through pages that aren't in pages.
+func findCycle(pages []Page, rules *RuleGraph) []Page {
+	cycle := findCycleInGraph(pages, rules)
+
+	if cycle == nil || rules.direct == nil {
+		return cycle
+	}
+
+	// Every rule in the closure's cycle (which could be a single rule a|a) stands for a chain of direct rules
+	directCycle := []Page{cycle[0]}
+
+	for i := 1; i < len(cycle); i++ {
+		chain := rules.direct.Chain(cycle[i-1], cycle[i])
+		directCycle = append(directCycle, chain[1:]...)
+	}
+
+	return directCycle
+}
+
+func findCycleInGraph(pages []Page, rules *RuleGraph) []Page {
+	inPages := make(map[Page]bool, len(pages))
+
+	for _, page := range pages {
+		inPages[page] = true
+	}
+
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+
+	state := make(map[Page]int, len(pages))
+	path := make([]Page, 0)
+
+	// Depth-first search, which has found a cycle if it gets back to a page that's still in progress
+	var visit func(page Page) []Page
+
+	visit = func(page Page) []Page {
+		state[page] = inProgress
+		path = append(path, page)
+
+		// Successors are sorted, so the same cycle gets reported every time
+		for _, afterPage := range rules.Successors(page) {
+			if !inPages[afterPage] {
+				continue
+			}
+
+			switch state[afterPage] {
+			case inProgress:
+				cycleStart := slices.Index(path, afterPage)
+
+				return append(slices.Clone(path[cycleStart:]), afterPage)
+			case unvisited:
+				if cycle := visit(afterPage); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[page] = done
+
+		return nil
+	}
+
+	for _, page := range pages {
+		if state[page] == unvisited {
+			if cycle := visit(page); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatCycle(cycle []Page) string {
+	return strings.ReplaceAll(formatPages(cycle), ",", " -> ")
+}
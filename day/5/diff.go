@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// The rules that are in one rule set but not the other
+type RuleDiff struct {
+	Added   [][2]Page
+	Removed [][2]Page
+}
+
+func diffRules(oldRules *RuleGraph, newRules *RuleGraph) RuleDiff {
+	diff := RuleDiff{Added: make([][2]Page, 0), Removed: make([][2]Page, 0)}
+
+	for _, rule := range newRules.Rules() {
+		if !oldRules.MustPrecede(rule[0], rule[1]) {
+			diff.Added = append(diff.Added, rule)
+		}
+	}
+
+	for _, rule := range oldRules.Rules() {
+		if !newRules.MustPrecede(rule[0], rule[1]) {
+			diff.Removed = append(diff.Removed, rule)
+		}
+	}
+
+	return diff
+}
+
+// An update whose answer is different under the new rules
+type UpdateChange struct {
+	Old UpdateResult
+	New UpdateResult
+}
+
+// Updates that change between valid and invalid, or whose (fixed) middle page changes
+func changedUpdates(updatePages [][]Page, oldRules *RuleGraph, newRules *RuleGraph) []UpdateChange {
+	changes := make([]UpdateChange, 0)
+
+	for _, pages := range updatePages {
+		oldResult, newResult := checkUpdate(pages, oldRules), checkUpdate(pages, newRules)
+
+		if oldResult.Valid != newResult.Valid || describeMiddle(oldResult) != describeMiddle(newResult) {
+			changes = append(changes, UpdateChange{Old: oldResult, New: newResult})
+		}
+	}
+
+	return changes
+}
+
+func describeValidity(r UpdateResult) string {
+	if r.Valid {
+		return "valid"
+	}
+
+	return "invalid"
+}
+
+func describeMiddle(r UpdateResult) string {
+	if r.Middle == nil {
+		return "none (can't be fixed)"
+	}
+
+	return fmt.Sprint(*r.Middle)
+}
+
+func (c UpdateChange) String() string {
+	changes := make([]string, 0)
+
+	if c.Old.Valid != c.New.Valid {
+		changes = append(changes, fmt.Sprintf("%v -> %v", describeValidity(c.Old), describeValidity(c.New)))
+	}
+
+	if describeMiddle(c.Old) != describeMiddle(c.New) {
+		changes = append(changes, fmt.Sprintf("middle page %v -> %v", describeMiddle(c.Old), describeMiddle(c.New)))
+	}
+
+	return fmt.Sprintf("%v: %v", formatPages(c.Old.Update), strings.Join(changes, ", "))
+}
+
+// dayfive diff old-rules.txt new-rules.txt < updates.txt
+//
+// Updates are read from stdin, one per line. Rule lines (as in a full puzzle input) are skipped,
+// so a puzzle input works too.
+func runDiffCommand(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dayfive diff [-even-length warn] old-rules.txt new-rules.txt < updates.txt")
+		flags.PrintDefaults()
+	}
+	evenLength := flags.String("even-length", string(WarnEvenLength), "what to do with updates that have an even number of pages: allow, warn, skip or reject")
+
+	flags.Parse(args)
+
+	evenLengthPolicy, err := parseEvenLengthPolicy(*evenLength)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	oldRules, err := loadRuleGraph(flags.Arg(0))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	newRules, err := loadRuleGraph(flags.Arg(1))
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	updatePages, err := parseUpdateLines(os.Stdin, evenLengthPolicy, os.Stderr)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diff := diffRules(oldRules, newRules)
+
+	fmt.Printf("Added rules (%d):\n", len(diff.Added))
+
+	for _, rule := range diff.Added {
+		fmt.Printf("  %d|%d\n", rule[0], rule[1])
+	}
+
+	fmt.Printf("Removed rules (%d):\n", len(diff.Removed))
+
+	for _, rule := range diff.Removed {
+		fmt.Printf("  %d|%d\n", rule[0], rule[1])
+	}
+
+	changes := changedUpdates(updatePages, oldRules, newRules)
+
+	fmt.Printf("Changed updates (%d of %d):\n", len(changes), len(updatePages))
+
+	for _, change := range changes {
+		fmt.Printf("  %v\n", change)
+	}
+}
+
+func loadRuleGraph(path string) (*RuleGraph, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	rulePairs, err := parseRulesFile(file)
+
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return ruleGraphForRulePairs(rulePairs), nil
+}
+
+// Parses one update per line, skipping blank lines and rules.
+// Warnings from the even-length policy are written to warnings.
+func parseUpdateLines(r io.Reader, evenLengthPolicy EvenLengthPolicy, warnings io.Writer) ([][]Page, error) {
+	updatePages := make([][]Page, 0)
+	errs := make([]error, 0)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.Contains(line, "|") {
+			continue
+		}
+
+		pages, err := parseUpdate(line)
+
+		if err != nil {
+			errs = append(errs, &LineError{lineNum, err})
+			continue
+		}
+
+		warning, skip, err := checkEvenLength(pages, line, evenLengthPolicy)
+
+		if err != nil {
+			errs = append(errs, &LineError{lineNum, err})
+			continue
+		}
+
+		if warning != "" {
+			fmt.Fprintf(warnings, "line %d: %v\n", lineNum, warning)
+		}
+
+		if skip {
+			continue
+		}
+
+		updatePages = append(updatePages, pages)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return updatePages, err
+	}
+
+	return updatePages, errors.Join(errs...)
+}
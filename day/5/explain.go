@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+)
+
+// A rule that an update breaks, because After appears before Before
+type Violation struct {
+	// The rule is Before|After
+	Before Page
+	After  Page
+	// Where each page appears in the update
+	BeforeIndex int
+	AfterIndex  int
+}
+
+// Take a page out of the update and put it back in at a new position
+type Move struct {
+	Page Page
+	// From is the page's position in the original update, To is its position in the fixed update
+	From int
+	To   int
+}
+
+// Why an update is (or isn't) valid, and the fewest moves that would fix it
+type Explanation struct {
+	Pages      []Page
+	Violations []Violation
+	// If the update's rules contain a cycle, it can't be fixed, and Moves and Fixed are empty
+	Cycle []Page
+	Moves []Move
+	Fixed []Page
+}
+
+func explainPages(pages []Page, rules *RuleGraph) Explanation {
+	explanation := Explanation{Pages: pages}
+
+	for i, page := range pages {
+		for j := i + 1; j < len(pages); j++ {
+			if rules.MustPrecede(pages[j], page) {
+				explanation.Violations = append(explanation.Violations, Violation{
+					Before:      pages[j],
+					After:       page,
+					BeforeIndex: j,
+					AfterIndex:  i,
+				})
+			}
+		}
+	}
+
+	if len(explanation.Violations) == 0 {
+		explanation.Fixed = pages
+		return explanation
+	}
+
+	if cycle := findCycle(pages, rules); cycle != nil {
+		explanation.Cycle = cycle
+		return explanation
+	}
+
+	// Pages that are out of order with each other, even indirectly (e.g. a|b and b|c, with c before a),
+	// can't both stay where they are
+	mustPrecede := closureForPages(pages, rules)
+	conflicts := make([][]bool, len(pages))
+
+	for i := range pages {
+		conflicts[i] = make([]bool, len(pages))
+
+		for j := range pages {
+			conflicts[i][j] = (i < j && mustPrecede[j][i]) || (j < i && mustPrecede[i][j])
+		}
+	}
+
+	// Every page that isn't kept has to move. Any set of kept pages without conflicts
+	// can be extended to a valid order, so keeping as many as possible minimises the moves.
+	kept := make([]bool, len(pages))
+	keptIndexes := largestConflictFreeSet(conflicts, allIndexes(len(pages)))
+
+	for _, i := range keptIndexes {
+		kept[i] = true
+	}
+
+	slices.Sort(keptIndexes)
+
+	order := topologicalOrder(len(pages), func(i, j int) bool {
+		if mustPrecede[i][j] {
+			return true
+		}
+
+		// Kept pages stay in the same order relative to each other
+		k := slices.Index(keptIndexes, i)
+
+		return k != -1 && k+1 < len(keptIndexes) && keptIndexes[k+1] == j
+	})
+
+	for to, from := range order {
+		explanation.Fixed = append(explanation.Fixed, pages[from])
+
+		if !kept[from] {
+			explanation.Moves = append(explanation.Moves, Move{Page: pages[from], From: from, To: to})
+		}
+	}
+
+	slices.SortFunc(explanation.Moves, func(a, b Move) int {
+		return a.From - b.From
+	})
+
+	return explanation
+}
+
+// mustPrecede[i][j] is true if the rules require pages[i] to come before pages[j],
+// either directly or via other pages in the update
+func closureForPages(pages []Page, rules *RuleGraph) [][]bool {
+	mustPrecede := make([][]bool, len(pages))
+
+	for i, page := range pages {
+		mustPrecede[i] = make([]bool, len(pages))
+
+		for j, otherPage := range pages {
+			mustPrecede[i][j] = rules.MustPrecede(page, otherPage)
+		}
+	}
+
+	// Floyd-Warshall
+	for k := range pages {
+		for i := range pages {
+			if !mustPrecede[i][k] {
+				continue
+			}
+
+			for j := range pages {
+				if mustPrecede[k][j] {
+					mustPrecede[i][j] = true
+				}
+			}
+		}
+	}
+
+	return mustPrecede
+}
+
+// The largest subset of candidates with no conflicts between them (a maximum independent set).
+// This is exponential in the worst case, but updates are short, and it's rare to have to branch
+// since a candidate with at most one conflict can always be kept.
+func largestConflictFreeSet(conflicts [][]bool, candidates []int) []int {
+	if len(candidates) == 0 {
+		return []int{}
+	}
+
+	mostConflicted, mostConflicts := -1, -1
+
+	for _, i := range candidates {
+		count := 0
+
+		for _, j := range candidates {
+			if conflicts[i][j] {
+				count++
+			}
+		}
+
+		if count <= 1 {
+			return append(largestConflictFreeSet(conflicts, withoutConflicts(conflicts, candidates, i)), i)
+		}
+
+		if count > mostConflicts {
+			mostConflicted, mostConflicts = i, count
+		}
+	}
+
+	withIt := append(largestConflictFreeSet(conflicts, withoutConflicts(conflicts, candidates, mostConflicted)), mostConflicted)
+
+	withoutIt := largestConflictFreeSet(conflicts, slices.DeleteFunc(slices.Clone(candidates), func(j int) bool {
+		return j == mostConflicted
+	}))
+
+	if len(withoutIt) > len(withIt) {
+		return withoutIt
+	}
+
+	return withIt
+}
+
+// The candidates other than i and anything that conflicts with it
+func withoutConflicts(conflicts [][]bool, candidates []int, i int) []int {
+	return slices.DeleteFunc(slices.Clone(candidates), func(j int) bool {
+		return j == i || conflicts[i][j]
+	})
+}
+
+func allIndexes(n int) []int {
+	indexes := make([]int, n)
+
+	for i := range n {
+		indexes[i] = i
+	}
+
+	return indexes
+}
+
+// Positions are printed starting from 1
+func (e Explanation) Print(w io.Writer) {
+	update := formatPages(e.Pages)
+
+	if len(e.Violations) == 0 {
+		fmt.Fprintf(w, "%v is valid\n", update)
+		return
+	}
+
+	fmt.Fprintf(w, "%v is invalid, it breaks %d rule(s):\n", update, len(e.Violations))
+
+	for _, v := range e.Violations {
+		fmt.Fprintf(w, "  %v|%v: %v (position %d) comes after %v (position %d)\n", v.Before, v.After, v.Before, v.BeforeIndex+1, v.After, v.AfterIndex+1)
+	}
+
+	if e.Cycle != nil {
+		fmt.Fprintf(w, "  it can't be fixed, its rules contain a cycle: %v\n", formatCycle(e.Cycle))
+		return
+	}
+
+	fmt.Fprintf(w, "  fewest moves to fix it: %d\n", len(e.Moves))
+
+	for _, m := range e.Moves {
+		fmt.Fprintf(w, "    move %v from position %d to position %d\n", m.Page, m.From+1, m.To+1)
+	}
+
+	fmt.Fprintf(w, "  fixed: %v\n", formatPages(e.Fixed))
+}
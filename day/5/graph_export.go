@@ -0,0 +1,154 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// A rule, as an edge in an exported graph
+type exportEdge struct {
+	Before Page
+	After  Page
+	// Whether the update being exported breaks this rule
+	Violated bool
+}
+
+// Writes the rules as a graph in "dot" (Graphviz) or "mermaid" format.
+// If pages isn't nil, only the rules between those pages are included,
+// and any rules that their order breaks are drawn in red.
+func (g *RuleGraph) Export(w io.Writer, format string, pages []Page) error {
+	nodes, edges := g.exportNodesAndEdges(pages)
+
+	var b strings.Builder
+
+	switch format {
+	case "dot":
+		b.WriteString("digraph rules {\n")
+
+		for _, node := range nodes {
+			fmt.Fprintf(&b, "  %q;\n", fmt.Sprint(node))
+		}
+
+		for _, edge := range edges {
+			fmt.Fprintf(&b, "  %q -> %q", fmt.Sprint(edge.Before), fmt.Sprint(edge.After))
+
+			if edge.Violated {
+				b.WriteString(" [color=red, fontcolor=red, penwidth=2]")
+			}
+
+			b.WriteString(";\n")
+		}
+
+		b.WriteString("}\n")
+	case "mermaid":
+		b.WriteString("flowchart LR\n")
+
+		for _, node := range nodes {
+			fmt.Fprintf(&b, "  p%d[\"%d\"]\n", node, node)
+		}
+
+		violatedIndexes := make([]string, 0)
+
+		for i, edge := range edges {
+			fmt.Fprintf(&b, "  p%d --> p%d\n", edge.Before, edge.After)
+
+			if edge.Violated {
+				violatedIndexes = append(violatedIndexes, fmt.Sprint(i))
+			}
+		}
+
+		// Mermaid styles links by the order they were declared in
+		if len(violatedIndexes) > 0 {
+			fmt.Fprintf(&b, "  linkStyle %s stroke:red,stroke-width:2px\n", strings.Join(violatedIndexes, ","))
+		}
+	default:
+		return fmt.Errorf("unknown graph format %q (expected dot or mermaid)", format)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// The pages and rules to export. If pages is nil, that's every rule;
+// otherwise it's only the rules between those pages.
+func (g *RuleGraph) exportNodesAndEdges(pages []Page) ([]Page, []exportEdge) {
+	if pages == nil {
+		nodes := g.Pages()
+		edges := make([]exportEdge, 0)
+
+		for _, rule := range g.Rules() {
+			edges = append(edges, exportEdge{Before: rule[0], After: rule[1]})
+		}
+
+		return nodes, edges
+	}
+
+	edges := make([]exportEdge, 0)
+
+	for i, page := range pages {
+		for _, after := range g.Successors(page) {
+			j := slices.Index(pages, after)
+
+			if j == -1 {
+				continue
+			}
+
+			edges = append(edges, exportEdge{Before: page, After: after, Violated: j < i})
+		}
+	}
+
+	return pages, edges
+}
+
+// dayfive export [-format dot|mermaid] [-update 75,47,61,53,29] < input.txt (or a file of just rules)
+func runExportCommand(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "dot", "graph format: dot or mermaid")
+	update := flags.String("update", "", "only export the rules between this update's pages (e.g. 75,47,61), highlighting any it breaks")
+	out := flags.String("out", "", "file to write the graph to (default stdout)")
+
+	flags.Parse(args)
+
+	// The updates (if any) aren't needed, since -update gives the pages to export
+	rulePairs, err := parseRulesFile(os.Stdin)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var pages []Page
+
+	if *update != "" {
+		pages, err = parseUpdate(*update)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := io.Writer(os.Stdout)
+
+	if *out != "" {
+		file, err := os.Create(*out)
+
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		defer file.Close()
+
+		w = file
+	}
+
+	err = ruleGraphForRulePairs(rulePairs).Export(w, *format, pages)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,48 +1,95 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
+	"log"
 	"os"
-	"strconv"
-	"strings"
 )
 
-// Key: a page number, Value: a map with keys of the pages that this page must appear *before*, each of which has the val `true`
-// E.g., { "5": { "99": true }, "7", { "6": true, "54": true } }
-type Rules map[string](map[string]bool)
-
 func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "export":
+			runExportCommand(os.Args[2:])
+			return
+		case "serve":
+			runServeCommand(os.Args[2:])
+			return
+		case "diff":
+			runDiffCommand(os.Args[2:])
+			return
+		}
+	}
 
-	rulePairs := make([][]string, 0)
-	updatePages := make([][]string, 0)
-	haveSeenBlankLine := false
+	cycles := flag.String("cycles", string(SkipCycles), "what to do with invalid updates whose rules contain a cycle: skip or flag")
+	explain := flag.Bool("explain", false, "explain why each update is valid or invalid, and how to fix it")
+	transitive := flag.Bool("transitive", false, "validate against the transitive closure of the rules (a|b and b|c imply a|c)")
+	orderingsLimit := flag.Int("orderings", 0, "count the valid orderings of each invalid update, up to this many (0 to skip)")
+	evenLength := flag.String("even-length", string(WarnEvenLength), "what to do with updates that have an even number of pages: allow, warn, skip or reject")
+	flag.Parse()
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	cyclePolicy, err := parseCyclePolicy(*cycles)
 
-		if line == "" {
-			haveSeenBlankLine = true
-		} else if !haveSeenBlankLine {
-			rulePairs = append(rulePairs, strings.Split(line, "|"))
-		} else {
-			updatePages = append(updatePages, strings.Split(line, ","))
-		}
+	if err != nil {
+		log.Fatal(err)
 	}
 
+	evenLengthPolicy, err := parseEvenLengthPolicy(*evenLength)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	input, err := parseInput(os.Stdin, evenLengthPolicy, os.Stderr)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rulePairs, updatePages := input.RulePairs, input.Updates
+
 	fmt.Println("rulePairs:")
 	fmt.Printf("%v\n\n", rulePairs)
 
 	fmt.Println("updatePages:")
 	fmt.Printf("%v\n\n", updatePages)
 
-	rules := rulesForRulePairs(rulePairs)
+	rules := ruleGraphForRulePairs(rulePairs)
+
+	fmt.Printf("%v\n", rules)
+
+	if *transitive {
+		closure := rules.TransitiveClosure()
+
+		fmt.Println("Updates whose validity changes with transitive rules:")
+
+		for _, pages := range updatesWithDifferentValidity(updatePages, rules, closure) {
+			fmt.Printf("%v (valid with direct rules: %v)\n", pages, arePagesValid(pages, rules))
+		}
+
+		fmt.Println("")
+
+		rules = closure
+	}
 
-	fmt.Printf("%+v\n", rules)
+	if cycle := findCycle(rules.Pages(), rules); cycle != nil {
+		// This is fine as long as no single update's pages contain a cycle
+		fmt.Printf("NOTE: the full rule set contains a cycle: %v\n", formatCycle(cycle))
+	}
 
 	validPages, invalidPages := validAndInvalidUpdatePages(updatePages, rules)
 
+	if *explain {
+		fmt.Println("Explanations:")
+
+		for _, pages := range updatePages {
+			explainPages(pages, rules).Print(os.Stdout)
+		}
+
+		fmt.Println("")
+	}
+
 	fmt.Println("Valid pages:")
 	fmt.Println(validPages)
 
@@ -56,33 +103,35 @@ func main() {
 
 	fmt.Println("")
 
-	fixedInvalidPages := fixInvalidPages(invalidPages, rules)
+	fixedInvalidPages := fixInvalidPages(invalidPages, rules, cyclePolicy)
 
 	fmt.Println("Part 2 answer:")
 	fmt.Println(sumMiddlePages(fixedInvalidPages))
-}
 
-func rulesForRulePairs(rulePairs [][]string) Rules {
-	rules := Rules{}
+	if *orderingsLimit > 0 {
+		fmt.Println("")
+		fmt.Println("Valid orderings of invalid pages:")
 
-	for _, rulePair := range rulePairs {
-		left, right := rulePair[0], rulePair[1]
+		ambiguousCount := 0
 
-		if afterPages, pageExists := rules[left]; pageExists {
-			afterPages[right] = true
-		} else {
-			afterPages := make(map[string]bool)
-			afterPages[right] = true
-			rules[left] = afterPages
+		for _, pages := range invalidPages {
+			summary := summarizeOrderings(pages, rules, *orderingsLimit)
+			summary.Print(os.Stdout, pages)
+
+			if len(summary.MiddlePages) > 1 {
+				ambiguousCount++
+			}
 		}
-	}
 
-	return rules
+		if ambiguousCount > 0 {
+			fmt.Printf("NOTE: the part 2 answer depends on how ties are broken for %d update(s)\n", ambiguousCount)
+		}
+	}
 }
 
-func validAndInvalidUpdatePages(updatePages [][]string, rules Rules) ([][]string, [][]string) {
-	validUpdatePages := make([][]string, 0)
-	invalidUpdatePages := make([][]string, 0)
+func validAndInvalidUpdatePages(updatePages [][]Page, rules *RuleGraph) ([][]Page, [][]Page) {
+	validUpdatePages := make([][]Page, 0)
+	invalidUpdatePages := make([][]Page, 0)
 
 	for _, pages := range updatePages {
 		valid := arePagesValid(pages, rules)
@@ -97,14 +146,27 @@ func validAndInvalidUpdatePages(updatePages [][]string, rules Rules) ([][]string
 	return validUpdatePages, invalidUpdatePages
 }
 
-func arePagesValid(pages []string, rules Rules) bool {
+// Updates that are valid under one set of rules but invalid under the other
+func updatesWithDifferentValidity(updatePages [][]Page, rules *RuleGraph, otherRules *RuleGraph) [][]Page {
+	different := make([][]Page, 0)
+
+	for _, pages := range updatePages {
+		if arePagesValid(pages, rules) != arePagesValid(pages, otherRules) {
+			different = append(different, pages)
+		}
+	}
+
+	return different
+}
+
+func arePagesValid(pages []Page, rules *RuleGraph) bool {
 	valid := true
 
-	pagesSeen := make([]string, 0)
+	pagesSeen := make([]Page, 0)
 
 	for _, page := range pages {
 		for _, pageSeen := range pagesSeen {
-			if rules[page][pageSeen] {
+			if rules.MustPrecede(page, pageSeen) {
 				valid = false
 				break
 			}
@@ -120,11 +182,24 @@ func arePagesValid(pages []string, rules Rules) bool {
 	return valid
 }
 
-func fixInvalidPages(invalidPages [][]string, rules Rules) [][]string {
-	fixedPages := make([][]string, 0)
+func fixInvalidPages(invalidPages [][]Page, rules *RuleGraph, cyclePolicy CyclePolicy) [][]Page {
+	fixedPages := make([][]Page, 0)
+	skippedCount := 0
 
 	for _, pages := range invalidPages {
-		attempt := tryFixPages(pages, rules)
+		if cycle := findCycle(pages, rules); cycle != nil {
+			fmt.Fprintf(os.Stderr, "Can't fix pages %v, their rules contain a cycle: %v\n", pages, formatCycle(cycle))
+
+			if cyclePolicy == SkipCycles {
+				skippedCount++
+			} else {
+				fixedPages = append(fixedPages, sortPages(pages, rules))
+			}
+
+			continue
+		}
+
+		attempt := sortPages(pages, rules)
 
 		if arePagesValid(attempt, rules) {
 			fmt.Printf("Success! Fixed pages with attempt: %v\n", attempt)
@@ -137,7 +212,7 @@ func fixInvalidPages(invalidPages [][]string, rules Rules) [][]string {
 		}
 	}
 
-	if len(fixedPages) != len(invalidPages) {
+	if len(fixedPages)+skippedCount != len(invalidPages) {
 		fmt.Fprintf(os.Stderr, "Length of fixedPages doesn't match length of invalidPages, WHY NOT???\n")
 		fmt.Fprintf(os.Stderr, "len(fixedPages): %v, len(invalidPages): %v\n", len(fixedPages), len(invalidPages))
 		os.Exit(1)
@@ -146,77 +221,82 @@ func fixInvalidPages(invalidPages [][]string, rules Rules) [][]string {
 	return fixedPages
 }
 
-func tryFixPages(pages []string, rules Rules) []string {
-	invalidPage := ""
-	invalidPageIndex := -1
-	mustGoBeforeIndex := -1
+// Reorders pages so that every rule between them is satisfied, using Kahn's algorithm
+// on the rules restricted to these pages. When several pages could go next,
+// the one that came first originally wins, so the result is deterministic.
+func sortPages(pages []Page, rules *RuleGraph) []Page {
+	order := topologicalOrder(len(pages), func(i, j int) bool {
+		return rules.MustPrecede(pages[i], pages[j])
+	})
 
-	pagesSeen := make([]string, 0)
+	sorted := make([]Page, 0, len(pages))
 
-	for i, page := range pages {
-		for j, pageSeen := range pagesSeen {
-			if rules[page][pageSeen] {
-				invalidPage = page
-				invalidPageIndex = i
-				mustGoBeforeIndex = j
-				break
-			}
-		}
-
-		if invalidPage != "" {
-			break
-		}
-
-		pagesSeen = append(pagesSeen, page)
+	for _, i := range order {
+		sorted = append(sorted, pages[i])
 	}
 
-	if invalidPage == "" {
-		fmt.Fprintf(os.Stderr, "Didn't find invalid page, WHY NOT???\n")
-		os.Exit(1)
-	}
+	return sorted
+}
 
-	if invalidPageIndex == -1 {
-		fmt.Fprintf(os.Stderr, "No invalid page index, WHY NOT???\n")
-		os.Exit(1)
+// Orders the indexes 0 to n-1 so that i comes before j wherever mustPrecede(i, j),
+// preferring lower indexes when there's a choice. If the constraints form a cycle,
+// the indexes in it are left at the end, in their original order.
+func topologicalOrder(n int, mustPrecede func(i, j int) bool) []int {
+	// How many of the other indexes must come before each index
+	inDegree := make([]int, n)
+
+	for i := range n {
+		for j := range n {
+			if mustPrecede(i, j) {
+				inDegree[j]++
+			}
+		}
 	}
 
-	if mustGoBeforeIndex == -1 {
-		fmt.Fprintf(os.Stderr, "No must-go-before index, WHY NOT???\n")
-		os.Exit(1)
-	}
+	placed := make([]bool, n)
+	order := make([]int, 0, n)
 
-	fmt.Printf("invalidPage: %v, invalidPageIndex: %v, mustGoBeforeIndex: %v\n", invalidPage, invalidPageIndex, mustGoBeforeIndex)
+	for len(order) < n {
+		next := -1
 
-	attempt := append(make([]string, 0), pages[:mustGoBeforeIndex]...)
-	attempt = append(attempt, invalidPage)
-	attempt = append(attempt, pages[mustGoBeforeIndex:invalidPageIndex]...)
-	attempt = append(attempt, pages[invalidPageIndex+1:]...)
+		for i := range n {
+			if !placed[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+			// The remaining indexes form a cycle, so there's no valid order for them
+			for i := range n {
+				if !placed[i] {
+					order = append(order, i)
+				}
+			}
 
-	if arePagesValid(attempt, rules) {
-		fmt.Printf("Success! Fixed pages with attempt: %v\n", attempt)
+			break
+		}
 
-		return attempt
-	} else {
-		fmt.Println("Trying again!")
+		placed[next] = true
+		order = append(order, next)
 
-		return tryFixPages(attempt, rules)
+		for j := range n {
+			if mustPrecede(next, j) {
+				inDegree[j]--
+			}
+		}
 	}
+
+	return order
 }
 
-func sumMiddlePages(updatePages [][]string) int {
+func sumMiddlePages(updatePages [][]Page) int {
 	total := 0
 
 	for _, pages := range updatePages {
 		middleIndex := len(pages) / 2
 
-		num, err := strconv.Atoi(pages[middleIndex])
-
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Couldn't parse middle num, WHAT???\n")
-			os.Exit(1)
-		}
-
-		total += num
+		total += int(pages[middleIndex])
 	}
 
 	return total
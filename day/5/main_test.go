@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"testing"
+)
+
+func inputForFile(t testing.TB, name string) Input {
+	t.Helper()
+
+	file, err := os.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	input, err := parseInput(file, AllowEvenLength, io.Discard)
+
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+
+	return input
+}
+
+func TestSortPages(t *testing.T) {
+	tests := []struct {
+		file string
+		want int
+	}{
+		{"test1.txt", 123},
+		{"input.txt", 6305},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			input := inputForFile(t, test.file)
+			rules := ruleGraphForRulePairs(input.RulePairs)
+			_, invalidPages := validAndInvalidUpdatePages(input.Updates, rules)
+
+			fixedPages := make([][]Page, 0, len(invalidPages))
+
+			for _, pages := range invalidPages {
+				fixed := sortPages(pages, rules)
+
+				if !arePagesValid(fixed, rules) {
+					t.Fatalf("sortPages(%v) = %v, which breaks a rule", pages, fixed)
+				}
+
+				fixedPages = append(fixedPages, fixed)
+			}
+
+			if got := sumMiddlePages(fixedPages); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// A chain of rules 1|2, 2|3, ..., with the update's pages in reverse, so every page is out of order
+func BenchmarkSortPages(b *testing.B) {
+	for _, length := range []int{25, 100, 400} {
+		b.Run(fmt.Sprint(length), func(b *testing.B) {
+			rules := NewRuleGraph()
+			pages := make([]Page, 0, length)
+
+			for page := range Page(length) {
+				if page > 0 {
+					rules.Add(page, page+1)
+				}
+
+				pages = append(pages, page+1)
+			}
+
+			slices.Reverse(pages)
+
+			for range b.N {
+				sortPages(pages, rules)
+			}
+		})
+	}
+}
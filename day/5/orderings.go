@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// How many ways an update's pages can be ordered without breaking any rules
+type OrderingSummary struct {
+	// The number of valid orderings, up to the limit it was counted to
+	Count int
+	// Whether there are more valid orderings than Count
+	AtLimit bool
+	// Every page that's in the middle of at least one valid ordering, in update order
+	MiddlePages []Page
+}
+
+func (s OrderingSummary) IsUnique() bool {
+	return s.Count == 1 && !s.AtLimit
+}
+
+// Counts the valid orderings of pages (stopping once there are more than limit),
+// and finds which pages could end up in the middle
+func summarizeOrderings(pages []Page, rules *RuleGraph, limit int) OrderingSummary {
+	summary := OrderingSummary{}
+
+	if findCycle(pages, rules) != nil {
+		// There are no valid orderings
+		return summary
+	}
+
+	mustPrecede := closureForPages(pages, rules)
+	middleIndex := len(pages) / 2
+
+	// A page can go anywhere between its last (transitive) predecessor and its first successor,
+	// so it can be in the middle if that isn't ruled out by how many of either it has
+	for i, page := range pages {
+		predecessorCount, successorCount := 0, 0
+
+		for j := range pages {
+			if mustPrecede[j][i] {
+				predecessorCount++
+			}
+
+			if mustPrecede[i][j] {
+				successorCount++
+			}
+		}
+
+		if predecessorCount <= middleIndex && successorCount <= len(pages)-1-middleIndex {
+			summary.MiddlePages = append(summary.MiddlePages, page)
+		}
+	}
+
+	summary.Count = countOrderings(len(pages), func(i, j int) bool {
+		return rules.MustPrecede(pages[i], pages[j])
+	}, limit+1)
+
+	if summary.Count > limit {
+		summary.Count = limit
+		summary.AtLimit = true
+	}
+
+	return summary
+}
+
+// Counts the orderings of indexes 0 to n-1 where i comes before j wherever mustPrecede(i, j),
+// stopping at limit. The constraints must not contain a cycle.
+func countOrderings(n int, mustPrecede func(i, j int) bool, limit int) int {
+	// How many unplaced indexes must come before each index
+	inDegree := make([]int, n)
+
+	for i := range n {
+		for j := range n {
+			if mustPrecede(i, j) {
+				inDegree[j]++
+			}
+		}
+	}
+
+	placed := make([]bool, n)
+	count := 0
+
+	// Try every index that could go next, then undo it and try the others
+	var placeNext func(placedCount int)
+
+	placeNext = func(placedCount int) {
+		if placedCount == n {
+			count++
+			return
+		}
+
+		for i := range n {
+			if count >= limit {
+				return
+			}
+
+			if placed[i] || inDegree[i] != 0 {
+				continue
+			}
+
+			placed[i] = true
+
+			for j := range n {
+				if mustPrecede(i, j) {
+					inDegree[j]--
+				}
+			}
+
+			placeNext(placedCount + 1)
+
+			for j := range n {
+				if mustPrecede(i, j) {
+					inDegree[j]++
+				}
+			}
+
+			placed[i] = false
+		}
+	}
+
+	placeNext(0)
+
+	return count
+}
+
+func (s OrderingSummary) Print(w io.Writer, pages []Page) {
+	switch {
+	case s.Count == 0:
+		fmt.Fprintf(w, "%v has no valid orderings\n", formatPages(pages))
+	case s.IsUnique():
+		fmt.Fprintf(w, "%v has a unique valid ordering\n", formatPages(pages))
+	case s.AtLimit:
+		fmt.Fprintf(w, "%v has more than %d valid orderings, possible middle pages: %v\n", formatPages(pages), s.Count, formatPages(s.MiddlePages))
+	default:
+		fmt.Fprintf(w, "%v has %d valid orderings, possible middle pages: %v\n", formatPages(pages), s.Count, formatPages(s.MiddlePages))
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The puzzle input: a section of rules, then a blank line, then a section of updates
+type Input struct {
+	RulePairs [][2]Page
+	Updates   [][]Page
+}
+
+// What to do with updates that have an even number of pages, since they don't have a single middle page
+type EvenLengthPolicy string
+
+const (
+	// Keep the update, and use the later of the two middle pages
+	AllowEvenLength EvenLengthPolicy = "allow"
+	// Like AllowEvenLength, but print a warning
+	WarnEvenLength EvenLengthPolicy = "warn"
+	// Leave the update out, and print a warning
+	SkipEvenLength EvenLengthPolicy = "skip"
+	// Treat the update as malformed
+	RejectEvenLength EvenLengthPolicy = "reject"
+)
+
+func parseEvenLengthPolicy(s string) (EvenLengthPolicy, error) {
+	switch policy := EvenLengthPolicy(s); policy {
+	case AllowEvenLength, WarnEvenLength, SkipEvenLength, RejectEvenLength:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown even-length policy %q (expected allow, warn, skip or reject)", s)
+}
+
+// A problem with one line of the input. Line numbers start from 1.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Parses and validates the whole input. Every malformed line is reported, not just the first.
+// Warnings (e.g. about even-length updates) are written to warnings.
+func parseInput(r io.Reader, evenLengthPolicy EvenLengthPolicy, warnings io.Writer) (Input, error) {
+	input := Input{RulePairs: make([][2]Page, 0), Updates: make([][]Page, 0)}
+	errs := make([]error, 0)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	inUpdates := false
+	haveSeenBlankLine := false
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			// Blank lines before the rules or after the updates are harmless.
+			// Rules that failed to parse still count, so one bad rules section doesn't make every update a bad rule too
+			if len(input.RulePairs) > 0 || len(errs) > 0 || inUpdates {
+				haveSeenBlankLine = true
+			}
+
+			continue
+		}
+
+		if haveSeenBlankLine {
+			if inUpdates {
+				errs = append(errs, &LineError{lineNum, errors.New("unexpected text after the updates (the input should be rules, a blank line, then updates)")})
+				break
+			}
+
+			inUpdates = true
+			haveSeenBlankLine = false
+		}
+
+		if !inUpdates {
+			rulePair, err := parseRule(line)
+
+			if err != nil && strings.Contains(line, ",") && !strings.Contains(line, "|") {
+				err = fmt.Errorf("%w (this looks like an update, is the blank line after the rules missing?)", err)
+			}
+
+			if err != nil {
+				errs = append(errs, &LineError{lineNum, err})
+				continue
+			}
+
+			input.RulePairs = append(input.RulePairs, rulePair)
+			continue
+		}
+
+		pages, err := parseUpdate(line)
+
+		if err != nil {
+			errs = append(errs, &LineError{lineNum, err})
+			continue
+		}
+
+		warning, skip, err := checkEvenLength(pages, line, evenLengthPolicy)
+
+		if err != nil {
+			errs = append(errs, &LineError{lineNum, err})
+			continue
+		}
+
+		if warning != "" {
+			fmt.Fprintf(warnings, "line %d: %v\n", lineNum, warning)
+		}
+
+		if skip {
+			continue
+		}
+
+		input.Updates = append(input.Updates, pages)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return input, err
+	}
+
+	if len(errs) == 0 && len(input.RulePairs) == 0 {
+		errs = append(errs, errors.New("the input doesn't have any rules"))
+	}
+
+	if len(errs) == 0 && !inUpdates {
+		errs = append(errs, errors.New("the input doesn't have any updates (they should follow a blank line after the rules)"))
+	}
+
+	return input, errors.Join(errs...)
+}
+
+// Applies the even-length policy to an update. Returns a warning to report (or ""), whether to leave the update out,
+// and an error if the policy rejects it.
+func checkEvenLength(pages []Page, line string, policy EvenLengthPolicy) (string, bool, error) {
+	if len(pages)%2 != 0 {
+		return "", false, nil
+	}
+
+	message := fmt.Sprintf("update %q has an even number of pages, so it has no single middle page", line)
+
+	switch policy {
+	case WarnEvenLength:
+		return message + ", using the later of the two", false, nil
+	case SkipEvenLength:
+		return message + ", skipping it", true, nil
+	case RejectEvenLength:
+		return "", true, errors.New(message)
+	}
+
+	return "", false, nil
+}
+
+func parsePage(s string) (Page, error) {
+	num, err := strconv.Atoi(strings.TrimSpace(s))
+
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("%q is not a page number", s)
+	}
+
+	return Page(num), nil
+}
+
+// Parses a rule like "47|53"
+func parseRule(line string) ([2]Page, error) {
+	left, right, found := strings.Cut(line, "|")
+
+	if !found {
+		return [2]Page{}, fmt.Errorf("rule %q should look like X|Y", line)
+	}
+
+	before, err := parsePage(left)
+
+	if err != nil {
+		return [2]Page{}, fmt.Errorf("rule %q: %w", line, err)
+	}
+
+	after, err := parsePage(right)
+
+	if err != nil {
+		return [2]Page{}, fmt.Errorf("rule %q: %w", line, err)
+	}
+
+	if before == after {
+		return [2]Page{}, fmt.Errorf("rule %q: a page can't come before itself", line)
+	}
+
+	return [2]Page{before, after}, nil
+}
+
+// Parses an update like "75,47,61,53,29"
+func parseUpdate(line string) ([]Page, error) {
+	pages := make([]Page, 0)
+
+	for _, field := range strings.Split(line, ",") {
+		page, err := parsePage(field)
+
+		if err != nil {
+			return nil, fmt.Errorf("update %q: %w", line, err)
+		}
+
+		if slices.Contains(pages, page) {
+			return nil, fmt.Errorf("update %q: page %d appears more than once", line, page)
+		}
+
+		pages = append(pages, page)
+	}
+
+	return pages, nil
+}
+
+// Parses the rules from a file of rules, or a full puzzle input (whose updates are ignored)
+func parseRulesFile(r io.Reader) ([][2]Page, error) {
+	rulePairs := make([][2]Page, 0)
+	errs := make([]error, 0)
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			if len(rulePairs) > 0 || len(errs) > 0 {
+				// The end of the rules section
+				break
+			}
+
+			continue
+		}
+
+		rulePair, err := parseRule(line)
+
+		if err != nil {
+			errs = append(errs, &LineError{lineNum, err})
+			continue
+		}
+
+		rulePairs = append(rulePairs, rulePair)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return rulePairs, err
+	}
+
+	if len(errs) == 0 && len(rulePairs) == 0 {
+		errs = append(errs, errors.New("the file doesn't have any rules"))
+	}
+
+	return rulePairs, errors.Join(errs...)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A page number
+type Page int
+
+// The page ordering rules, as a directed graph with an edge from X to Y for each rule X|Y
+type RuleGraph struct {
+	// Key: a page, Value: the pages that this page must appear *before*
+	successors map[Page]map[Page]bool
+	// Key: a page, Value: the pages that this page must appear *after*
+	predecessors map[Page]map[Page]bool
+	// If this is a transitive closure, the rules it was built from (see TransitiveClosure)
+	direct *RuleGraph
+}
+
+func NewRuleGraph() *RuleGraph {
+	return &RuleGraph{
+		successors:   make(map[Page]map[Page]bool),
+		predecessors: make(map[Page]map[Page]bool),
+	}
+}
+
+// Adds the rule before|after
+func (g *RuleGraph) Add(before Page, after Page) {
+	if g.successors[before] == nil {
+		g.successors[before] = make(map[Page]bool)
+	}
+
+	if g.predecessors[after] == nil {
+		g.predecessors[after] = make(map[Page]bool)
+	}
+
+	g.successors[before][after] = true
+	g.predecessors[after][before] = true
+}
+
+// Whether there's a rule a|b
+func (g *RuleGraph) MustPrecede(a Page, b Page) bool {
+	return g.successors[a][b]
+}
+
+// Whether a must come before b, either from a rule a|b or a chain of rules (a|x, x|y, ..., z|b).
+// NOTE: if the rules contain a cycle, every page in it must precede every other (and itself)
+func (g *RuleGraph) MustPrecedeTransitively(a Page, b Page) bool {
+	return slices.Contains(g.Descendants(a), b)
+}
+
+// The pages that p must come directly before, in ascending order
+func (g *RuleGraph) Successors(p Page) []Page {
+	return slices.Sorted(maps.Keys(g.successors[p]))
+}
+
+// The pages that p must come directly after, in ascending order
+func (g *RuleGraph) Predecessors(p Page) []Page {
+	return slices.Sorted(maps.Keys(g.predecessors[p]))
+}
+
+// Every page that p must come before, directly or through a chain of rules, in ascending order
+func (g *RuleGraph) Descendants(p Page) []Page {
+	seen := make(map[Page]bool)
+	toVisit := g.Successors(p)
+
+	for len(toVisit) > 0 {
+		page := toVisit[len(toVisit)-1]
+		toVisit = toVisit[:len(toVisit)-1]
+
+		if seen[page] {
+			continue
+		}
+
+		seen[page] = true
+		toVisit = append(toVisit, g.Successors(page)...)
+	}
+
+	return slices.Sorted(maps.Keys(seen))
+}
+
+// A new graph with a rule a|b wherever a must precede b transitively.
+// NOTE: if the rules contain a cycle, the closure has a rule a|a for every page a in it
+func (g *RuleGraph) TransitiveClosure() *RuleGraph {
+	closure := NewRuleGraph()
+	closure.direct = g
+
+	for _, page := range g.Pages() {
+		for _, descendant := range g.Descendants(page) {
+			closure.Add(page, descendant)
+		}
+	}
+
+	return closure
+}
+
+// The shortest chain of rules from one page to another (or back to itself), e.g. [47, 61, 29] for 47|61 and 61|29,
+// or nil if there isn't one
+func (g *RuleGraph) Chain(from Page, to Page) []Page {
+	// Key: a page, Value: the page before it on the shortest chain from "from"
+	previous := make(map[Page]Page)
+	toVisit := []Page{from}
+
+	for len(toVisit) > 0 {
+		page := toVisit[0]
+		toVisit = toVisit[1:]
+
+		for _, afterPage := range g.Successors(page) {
+			if _, ok := previous[afterPage]; ok {
+				continue
+			}
+
+			previous[afterPage] = page
+
+			if afterPage == to {
+				chain := []Page{to}
+
+				for chainPage := page; chainPage != from; chainPage = previous[chainPage] {
+					chain = append(chain, chainPage)
+				}
+
+				chain = append(chain, from)
+				slices.Reverse(chain)
+
+				return chain
+			}
+
+			toVisit = append(toVisit, afterPage)
+		}
+	}
+
+	return nil
+}
+
+// Every page mentioned by the rules, in ascending order
+func (g *RuleGraph) Pages() []Page {
+	pageSet := make(map[Page]bool)
+
+	for page := range g.successors {
+		pageSet[page] = true
+	}
+
+	for page := range g.predecessors {
+		pageSet[page] = true
+	}
+
+	return slices.Sorted(maps.Keys(pageSet))
+}
+
+// Every rule, as [before, after] pairs, sorted
+func (g *RuleGraph) Rules() [][2]Page {
+	rules := make([][2]Page, 0)
+
+	for _, before := range slices.Sorted(maps.Keys(g.successors)) {
+		for _, after := range g.Successors(before) {
+			rules = append(rules, [2]Page{before, after})
+		}
+	}
+
+	return rules
+}
+
+func (g *RuleGraph) String() string {
+	rules := make([]string, 0)
+
+	for _, rule := range g.Rules() {
+		rules = append(rules, fmt.Sprintf("%d|%d", rule[0], rule[1]))
+	}
+
+	return strings.Join(rules, " ")
+}
+
+func ruleGraphForRulePairs(rulePairs [][2]Page) *RuleGraph {
+	rules := NewRuleGraph()
+
+	for _, rulePair := range rulePairs {
+		rules.Add(rulePair[0], rulePair[1])
+	}
+
+	return rules
+}
+
+func formatPages(pages []Page) string {
+	formatted := make([]string, 0, len(pages))
+
+	for _, page := range pages {
+		formatted = append(formatted, strconv.Itoa(int(page)))
+	}
+
+	return strings.Join(formatted, ",")
+}
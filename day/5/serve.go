@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// The answer for a single update
+type UpdateResult struct {
+	Update []Page `json:"update"`
+	Valid  bool   `json:"valid"`
+	// The corrected order, if the update is invalid
+	Fixed []Page `json:"fixed,omitempty"`
+	// The middle page of the (fixed) update, unless it couldn't be fixed
+	Middle *Page `json:"middle,omitempty"`
+	// Why the update couldn't be fixed, if it couldn't
+	Cycle []Page `json:"cycle,omitempty"`
+	// Whether the even-length policy left the update out (so it wasn't checked)
+	Skipped bool `json:"skipped,omitempty"`
+	// From the even-length policy
+	Warning string `json:"warning,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func checkUpdate(pages []Page, rules *RuleGraph) UpdateResult {
+	result := UpdateResult{Update: pages, Valid: arePagesValid(pages, rules)}
+	ordered := pages
+
+	if !result.Valid {
+		if cycle := findCycle(pages, rules); cycle != nil {
+			result.Cycle = cycle
+			return result
+		}
+
+		result.Fixed = sortPages(pages, rules)
+		ordered = result.Fixed
+	}
+
+	middle := ordered[len(ordered)/2]
+	result.Middle = &middle
+
+	return result
+}
+
+func checkUpdateLine(line string, rules *RuleGraph, evenLengthPolicy EvenLengthPolicy) UpdateResult {
+	line = strings.TrimSpace(line)
+	pages, err := parseUpdate(line)
+
+	if err != nil {
+		return UpdateResult{Error: err.Error()}
+	}
+
+	warning, skip, err := checkEvenLength(pages, line, evenLengthPolicy)
+
+	if err != nil {
+		return UpdateResult{Update: pages, Error: err.Error()}
+	}
+
+	if skip {
+		return UpdateResult{Update: pages, Skipped: true, Warning: warning}
+	}
+
+	result := checkUpdate(pages, rules)
+	result.Warning = warning
+
+	return result
+}
+
+func (r UpdateResult) String() string {
+	var answer string
+
+	switch {
+	case r.Error != "":
+		return "error: " + r.Error
+	case r.Skipped:
+		return "warning: " + r.Warning
+	case r.Valid:
+		answer = fmt.Sprintf("%v: valid, middle page %d", formatPages(r.Update), *r.Middle)
+	case r.Cycle != nil:
+		answer = fmt.Sprintf("%v: invalid, can't be fixed because its rules contain a cycle: %v", formatPages(r.Update), formatCycle(r.Cycle))
+	default:
+		answer = fmt.Sprintf("%v: invalid, fixed %v, middle page %d", formatPages(r.Update), formatPages(r.Fixed), *r.Middle)
+	}
+
+	if r.Warning != "" {
+		answer += " (warning: " + r.Warning + ")"
+	}
+
+	return answer
+}
+
+// dayfive serve -rules rules.txt [-json] [-http localhost:8080] [-even-length warn]
+//
+// Loads the rules once, then checks updates as they arrive, either one per line on stdin,
+// or over HTTP at /check (GET with ?update=75,47,61, or POST with one update per line)
+func runServeCommand(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	rulesPath := flags.String("rules", "", "file to load the rules from (required, a full puzzle input works too)")
+	asJSON := flags.Bool("json", false, "answer stdin updates with a line of JSON each")
+	httpAddr := flags.String("http", "", "serve HTTP on this address (e.g. localhost:8080) instead of reading stdin")
+	evenLength := flags.String("even-length", string(WarnEvenLength), "what to do with updates that have an even number of pages: allow, warn, skip or reject")
+
+	flags.Parse(args)
+
+	evenLengthPolicy, err := parseEvenLengthPolicy(*evenLength)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *rulesPath == "" {
+		log.Fatal("serve needs -rules")
+	}
+
+	file, err := os.Open(*rulesPath)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rulePairs, err := parseRulesFile(file)
+	file.Close()
+
+	if err != nil {
+		log.Fatalf("%v: %v", *rulesPath, err)
+	}
+
+	// The rules are only read from here on, so they're safe to share between requests
+	rules := ruleGraphForRulePairs(rulePairs)
+
+	if *httpAddr != "" {
+		http.HandleFunc("/check", func(w http.ResponseWriter, r *http.Request) {
+			handleCheck(w, r, rules, evenLengthPolicy)
+		})
+
+		log.Printf("Loaded %d rules, listening on %v", len(rulePairs), *httpAddr)
+		log.Fatal(http.ListenAndServe(*httpAddr, nil))
+	}
+
+	err = serveLines(os.Stdin, os.Stdout, rules, evenLengthPolicy, *asJSON)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Answers each update as soon as its line is read
+func serveLines(r io.Reader, w io.Writer, rules *RuleGraph, evenLengthPolicy EvenLengthPolicy, asJSON bool) error {
+	scanner := bufio.NewScanner(r)
+	encoder := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		result := checkUpdateLine(line, rules, evenLengthPolicy)
+
+		var err error
+
+		if asJSON {
+			err = encoder.Encode(result)
+		} else {
+			_, err = fmt.Fprintln(w, result)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func handleCheck(w http.ResponseWriter, r *http.Request, rules *RuleGraph, evenLengthPolicy EvenLengthPolicy) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		result := checkUpdateLine(r.URL.Query().Get("update"), rules, evenLengthPolicy)
+
+		if result.Error != "" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+
+		_ = json.NewEncoder(w).Encode(result)
+	case http.MethodPost:
+		results := make([]UpdateResult, 0)
+		scanner := bufio.NewScanner(r.Body)
+
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) != "" {
+				results = append(results, checkUpdateLine(scanner.Text(), rules, evenLengthPolicy))
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(results)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "use GET with ?update=..., or POST with one update per line", http.StatusMethodNotAllowed)
+	}
+}
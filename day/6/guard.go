@@ -0,0 +1,178 @@
+package main
+
+// Which way the guard is facing
+type Direction int
+
+const (
+	North Direction = iota
+	East
+	South
+	West
+)
+
+func (d Direction) TurnRight() Direction {
+	return (d + 1) % 4
+}
+
+func (d Direction) TurnLeft() Direction {
+	return (d + 3) % 4
+}
+
+func (d Direction) Reverse() Direction {
+	return (d + 2) % 4
+}
+
+func (d Direction) String() string {
+	return [...]string{"north", "east", "south", "west"}[d]
+}
+
+// How the guard looks when it's facing this way
+func (d Direction) Glyph() string {
+	return [...]string{"^", ">", "v", "<"}[d]
+}
+
+func directionForGlyph(glyph string) (Direction, bool) {
+	switch glyph {
+	case "^":
+		return North, true
+	case ">":
+		return East, true
+	case "v":
+		return South, true
+	case "<":
+		return West, true
+	}
+
+	return North, false
+}
+
+type Pos struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+// The position one cell away in the given direction (which might be off the map)
+func (p Pos) Step(d Direction) Pos {
+	switch d {
+	case North:
+		return Pos{Row: p.Row - 1, Col: p.Col}
+	case East:
+		return Pos{Row: p.Row, Col: p.Col + 1}
+	case South:
+		return Pos{Row: p.Row + 1, Col: p.Col}
+	default:
+		return Pos{Row: p.Row, Col: p.Col - 1}
+	}
+}
+
+// How many steps in direction d it takes to get from p to other,
+// or false if other isn't straight ahead (or behind)
+func (p Pos) StepsTo(other Pos, d Direction) (int, bool) {
+	switch d {
+	case North:
+		return p.Row - other.Row, p.Col == other.Col
+	case East:
+		return other.Col - p.Col, p.Row == other.Row
+	case South:
+		return other.Row - p.Row, p.Col == other.Col
+	default:
+		return p.Col - other.Col, p.Row == other.Row
+	}
+}
+
+// Where the guard is, and which way it's facing
+type GuardState struct {
+	Pos Pos
+	Dir Direction
+}
+
+// The result of walking the guard until it leaves the map or starts going round in a loop
+type Patrol struct {
+	// Every state the guard was in, in order, starting with where it started
+	Path []GuardState
+	// Every cell the guard visited, in the order it first visited them
+	Visited []Pos
+	// For each cell in Visited, the index in Path where the guard first reached it
+	FirstVisits []int
+	// Whether the guard ended up in a loop (rather than leaving the map)
+	IsLoop bool
+	// If IsLoop, the index in Path where the loop starts (the guard then repeats Path[LoopStart:] forever)
+	LoopStart int
+}
+
+// Moves the guard one step: it turns (see Rules.Turn) if there's an obstacle ahead, otherwise it steps forwards.
+// extraObstacle (if not nil) is treated as an obstacle, on top of the ones on the map.
+// Returns false if the guard walks off the map.
+func (g *Grid) Step(state GuardState, extraObstacle *Pos) (GuardState, bool) {
+	return g.stepWith(state, withExtraObstacle(extraObstacle))
+}
+
+// Treats extraObstacle (if not nil) as an obstacle, on top of the ones on the map
+func withExtraObstacle(extraObstacle *Pos) func(*GridNode) bool {
+	return func(node *GridNode) bool {
+		return node.IsObstacle() || (extraObstacle != nil && node.Pos() == *extraObstacle)
+	}
+}
+
+// Like Step, but isObstacle decides which cells are obstacles, rather than the map
+func (g *Grid) stepWith(state GuardState, isObstacle func(*GridNode) bool) (GuardState, bool) {
+	node, ok := g.At(state.Pos)
+
+	if !ok {
+		return state, false
+	}
+
+	next, ok := node.Neighbour(state.Dir)
+
+	if !ok {
+		// Guard exited the grid!
+		return state, false
+	}
+
+	if isObstacle(next) {
+		return GuardState{Pos: state.Pos, Dir: g.Rules.Turn.From(state.Dir)}, true
+	}
+
+	return GuardState{Pos: next.Pos(), Dir: state.Dir}, true
+}
+
+// Walks the guard from start until it leaves the map or gets stuck in a loop.
+// This never changes the grid, so any number of simulations can share it.
+func (g *Grid) Simulate(start GuardState, extraObstacle *Pos) Patrol {
+	return g.simulateWith(start, withExtraObstacle(extraObstacle))
+}
+
+// Like Simulate, but isObstacle decides which cells are obstacles, rather than the map
+func (g *Grid) simulateWith(start GuardState, isObstacle func(*GridNode) bool) Patrol {
+	patrol := Patrol{Path: []GuardState{start}, Visited: []Pos{start.Pos}, FirstVisits: []int{0}}
+
+	// The index in Path of each state the guard has been in
+	seenStates := map[GuardState]int{start: 0}
+	visited := map[Pos]bool{start.Pos: true}
+	state := start
+
+	for {
+		next, ok := g.stepWith(state, isObstacle)
+
+		if !ok {
+			return patrol
+		}
+
+		if loopStart, ok := seenStates[next]; ok {
+			patrol.IsLoop = true
+			patrol.LoopStart = loopStart
+			return patrol
+		}
+
+		seenStates[next] = len(patrol.Path)
+		patrol.Path = append(patrol.Path, next)
+
+		if !visited[next.Pos] {
+			visited[next.Pos] = true
+			patrol.Visited = append(patrol.Visited, next.Pos)
+			patrol.FirstVisits = append(patrol.FirstVisits, len(patrol.Path)-1)
+		}
+
+		state = next
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+)
+
+// How a guard's patrol ended, when there's more than one guard
+type GuardOutcome string
+
+const (
+	// Walked off the map
+	Exited GuardOutcome = "exited"
+	// Ran into another guard, and stopped (see StopOnCollision)
+	Collided GuardOutcome = "collided"
+	// Still walking when the guards got back to a state they'd all been in before
+	Looping GuardOutcome = "looping"
+)
+
+type GuardResult struct {
+	Start GuardState
+	// Where the guard was when it exited or collided, or when the loop was found
+	End     GuardState
+	Outcome GuardOutcome
+	// How many steps the guard took (turns count as steps)
+	Steps int
+}
+
+// The result of walking every guard together until none of them are still walking, or they go round in a loop
+type GroupPatrol struct {
+	Guards []GuardResult
+	// Every cell any guard visited, in the order they were first visited
+	Visited []Pos
+	// How many steps were taken (every guard that's still walking takes one step at a time)
+	Ticks  int
+	IsLoop bool
+}
+
+// Walks every guard together, one step at a time, handling collisions with Rules.Collisions.
+// With PassThrough the guards can't affect each other, so each one is simulated on its own.
+func (g *Grid) SimulateGuards(starts []GuardState) GroupPatrol {
+	if g.Rules.Collisions == PassThrough {
+		return g.simulateGuardsSeparately(starts)
+	}
+
+	group := GroupPatrol{Guards: make([]GuardResult, len(starts))}
+	visited := make(map[Pos]bool)
+	walking := make([]bool, len(starts))
+	states := make([]GuardState, len(starts))
+
+	for i, start := range starts {
+		group.Guards[i] = GuardResult{Start: start, End: start}
+		walking[i] = true
+		states[i] = start
+
+		if !visited[start.Pos] {
+			visited[start.Pos] = true
+			group.Visited = append(group.Visited, start.Pos)
+		}
+	}
+
+	// Guards that have stopped never move again, so the state of the whole group is
+	// where the walking guards are, and which guards are walking
+	seenStates := make(map[string]bool)
+
+	for {
+		key := fmt.Sprint(states, walking)
+
+		if seenStates[key] {
+			group.IsLoop = true
+			break
+		}
+
+		seenStates[key] = true
+
+		next := make([]GuardState, len(states))
+		stillWalking := make([]bool, len(states))
+
+		// Where each walking guard is standing, for BlockEachOther
+		occupied := make(map[Pos]int)
+
+		for i, state := range states {
+			if walking[i] {
+				occupied[state.Pos] = i
+			}
+		}
+
+		for i, state := range states {
+			next[i] = state
+
+			if !walking[i] {
+				continue
+			}
+
+			var ok bool
+
+			if g.Rules.Collisions == BlockEachOther {
+				// Guards take their steps in order, so each one avoids where the guards before it have just moved to
+				next[i], ok = g.stepWith(state, func(node *GridNode) bool {
+					other, isOccupied := occupied[node.Pos()]
+					return node.IsObstacle() || (isOccupied && other != i)
+				})
+
+				delete(occupied, state.Pos)
+
+				if ok {
+					occupied[next[i].Pos] = i
+				}
+			} else {
+				next[i], ok = g.Step(state, nil)
+			}
+
+			if ok {
+				stillWalking[i] = true
+			} else {
+				group.Guards[i].Outcome = Exited
+			}
+		}
+
+		if g.Rules.Collisions == StopOnCollision {
+			// A guard that stops stays where it was, so another guard might have just walked into it there.
+			// Keep checking until no more guards collide.
+			for {
+				collided := collisions(states, next, stillWalking, group.Guards)
+
+				if len(collided) == 0 {
+					break
+				}
+
+				for _, i := range collided {
+					// Stay where it was, rather than walking into (or through) the other guard
+					next[i] = states[i]
+					stillWalking[i] = false
+					group.Guards[i].Outcome = Collided
+				}
+			}
+		}
+
+		anyWalking := false
+
+		for i := range states {
+			if !walking[i] {
+				continue
+			}
+
+			group.Guards[i].End = next[i]
+
+			if stillWalking[i] {
+				anyWalking = true
+				group.Guards[i].Steps++
+
+				if !visited[next[i].Pos] {
+					visited[next[i].Pos] = true
+					group.Visited = append(group.Visited, next[i].Pos)
+				}
+			}
+		}
+
+		states, walking = next, stillWalking
+		group.Ticks++
+
+		if !anyWalking {
+			break
+		}
+	}
+
+	for i := range group.Guards {
+		if walking[i] {
+			group.Guards[i].Outcome = Looping
+		}
+	}
+
+	return group
+}
+
+// The walking guards that run into another guard by moving from states to next: two of them step into the same cell
+// or swap cells, or one steps into a guard that has collided (and is standing where it was)
+func collisions(states []GuardState, next []GuardState, stillWalking []bool, guards []GuardResult) []int {
+	collided := make([]int, 0)
+
+	for i := range states {
+		if !stillWalking[i] {
+			continue
+		}
+
+		for j := range states {
+			if j == i {
+				continue
+			}
+
+			sameCell := stillWalking[j] && next[j].Pos == next[i].Pos
+			swapped := stillWalking[j] && next[j].Pos == states[i].Pos && next[i].Pos == states[j].Pos && next[i].Pos != states[i].Pos
+			intoStopped := guards[j].Outcome == Collided && states[j].Pos == next[i].Pos
+
+			if sameCell || swapped || intoStopped {
+				collided = append(collided, i)
+				break
+			}
+		}
+	}
+
+	return collided
+}
+
+func (g *Grid) simulateGuardsSeparately(starts []GuardState) GroupPatrol {
+	group := GroupPatrol{Guards: make([]GuardResult, len(starts))}
+	visited := make(map[Pos]bool)
+
+	for i, start := range starts {
+		patrol := g.Simulate(start, nil)
+
+		group.Guards[i] = GuardResult{Start: start, End: patrol.Path[len(patrol.Path)-1], Outcome: Exited, Steps: len(patrol.Path) - 1}
+		group.Ticks = max(group.Ticks, len(patrol.Path)-1)
+
+		if patrol.IsLoop {
+			group.Guards[i].Outcome = Looping
+			group.IsLoop = true
+		}
+
+		for _, pos := range patrol.Visited {
+			if !visited[pos] {
+				visited[pos] = true
+				group.Visited = append(group.Visited, pos)
+			}
+		}
+	}
+
+	return group
+}
+
+// Part 1 for a map with more than one guard. Part 2 assumes there's only one guard, so it's skipped.
+func printGroupPatrol(grid *Grid) {
+	group := grid.SimulateGuards(grid.GuardStarts)
+
+	visitedOverlay := make(map[Pos]string)
+
+	for _, pos := range group.Visited {
+		visitedOverlay[pos] = "X"
+	}
+
+	fmt.Println("")
+	fmt.Println("Part 1 grid:")
+	grid.Print(visitedOverlay)
+	fmt.Println("")
+
+	fmt.Println("")
+	fmt.Printf("Guards (collisions: %v):\n", grid.Rules.Collisions)
+
+	for i, guard := range group.Guards {
+		fmt.Printf("guard %d from %d,%d facing %v: %v at %d,%d facing %v after %d steps\n",
+			i+1, guard.Start.Pos.Row, guard.Start.Pos.Col, guard.Start.Dir,
+			guard.Outcome, guard.End.Pos.Row, guard.End.Pos.Col, guard.End.Dir, guard.Steps)
+	}
+
+	fmt.Println("")
+	fmt.Println("Total (Part 1):")
+	fmt.Println(len(group.Visited))
+
+	fmt.Println("")
+	fmt.Printf("Part 2 only supports a single guard, but the map has %d, so it's skipped\n", len(grid.GuardStarts))
+}
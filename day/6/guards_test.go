@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSimulateGuardsStopOnCollision(t *testing.T) {
+	// Guards 2 and 3 both step into 0,2 and stop, so guard 2 stays on 0,1, which guard 1 is stepping into
+	rules := DefaultRules
+	rules.Collisions = StopOnCollision
+
+	grid, err := buildGrid(bytes.NewReader([]byte(">>.<.\n.....\n")), rules)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	group := grid.SimulateGuards(grid.GuardStarts)
+	wantEnds := []Pos{{Row: 0, Col: 0}, {Row: 0, Col: 1}, {Row: 0, Col: 3}}
+
+	for i, guard := range group.Guards {
+		if guard.Outcome != Collided || guard.End.Pos != wantEnds[i] || guard.Steps != 0 {
+			t.Errorf("guard %d: got %v at %v after %d steps, want %v at %v after 0 steps", i+1, guard.Outcome, guard.End.Pos, guard.Steps, Collided, wantEnds[i])
+		}
+	}
+}
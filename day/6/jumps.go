@@ -0,0 +1,113 @@
+package main
+
+// Where the guard ends up if it walks in a straight line until it has to stop
+type jump struct {
+	// The last cell before an obstacle, or the cell on the edge of the map
+	To Pos
+	// Whether the guard walks off the map after To
+	Exits bool
+}
+
+// For every cell and direction, precomputes how far the guard walks before it reaches
+// an obstacle or the edge, so the guard can jump straight there instead of stepping one cell at a time
+func (g *Grid) buildJumpTable() {
+	g.jumps = make([][][4]jump, g.Height)
+
+	for row := range g.Height {
+		g.jumps[row] = make([][4]jump, g.Width)
+	}
+
+	// Sweep each row and column from the side the guard is walking towards,
+	// carrying along where it would stop
+	for row := range g.Height {
+		stop := jump{To: Pos{Row: row, Col: g.Width - 1}, Exits: true}
+
+		for col := g.Width - 1; col >= 0; col-- {
+			if g.nodes[row][col].IsObstacle() {
+				stop = jump{To: Pos{Row: row, Col: col - 1}}
+				continue
+			}
+
+			g.jumps[row][col][East] = stop
+		}
+
+		stop = jump{To: Pos{Row: row, Col: 0}, Exits: true}
+
+		for col := range g.Width {
+			if g.nodes[row][col].IsObstacle() {
+				stop = jump{To: Pos{Row: row, Col: col + 1}}
+				continue
+			}
+
+			g.jumps[row][col][West] = stop
+		}
+	}
+
+	for col := range g.Width {
+		stop := jump{To: Pos{Row: 0, Col: col}, Exits: true}
+
+		for row := range g.Height {
+			if g.nodes[row][col].IsObstacle() {
+				stop = jump{To: Pos{Row: row + 1, Col: col}}
+				continue
+			}
+
+			g.jumps[row][col][North] = stop
+		}
+
+		stop = jump{To: Pos{Row: g.Height - 1, Col: col}, Exits: true}
+
+		for row := g.Height - 1; row >= 0; row-- {
+			if g.nodes[row][col].IsObstacle() {
+				stop = jump{To: Pos{Row: row - 1, Col: col}}
+				continue
+			}
+
+			g.jumps[row][col][South] = stop
+		}
+	}
+}
+
+// Walks the guard straight ahead to the next obstacle, and turns it (see Rules.Turn).
+// A single extraObstacle (if not nil) is accounted for by cutting the jump short
+// if it's in the way, so the table never needs rebuilding.
+// Returns false if the guard walks off the map.
+func (g *Grid) Jump(state GuardState, extraObstacle *Pos) (GuardState, bool) {
+	j := g.jumps[state.Pos.Row][state.Pos.Col][state.Dir]
+
+	if extraObstacle != nil {
+		stepsToObstacle, ahead := state.Pos.StepsTo(*extraObstacle, state.Dir)
+		stepsToStop, _ := state.Pos.StepsTo(j.To, state.Dir)
+
+		if ahead && stepsToObstacle > 0 && stepsToObstacle <= stepsToStop {
+			j = jump{To: extraObstacle.Step(state.Dir.Reverse())}
+		}
+	}
+
+	if j.Exits {
+		return GuardState{Pos: j.To, Dir: state.Dir}, false
+	}
+
+	return GuardState{Pos: j.To, Dir: g.Rules.Turn.From(state.Dir)}, true
+}
+
+// Whether the guard gets stuck in a loop, using jumps rather than single steps
+func (g *Grid) IsLoop(start GuardState, extraObstacle *Pos) bool {
+	seenStates := map[GuardState]bool{start: true}
+	state := start
+
+	for {
+		next, ok := g.Jump(state, extraObstacle)
+
+		if !ok {
+			return false
+		}
+
+		if seenStates[next] {
+			return true
+		}
+
+		seenStates[next] = true
+		state = next
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The shape of the loop that an obstacle traps the guard in
+type LoopReport struct {
+	Obstacle Pos
+	// How many steps (from where it starts) the guard takes before it enters the loop
+	EntryStep int
+	// How many steps it takes to go round the loop once (turns count as steps)
+	Length int
+	// The cells the guard walks through on the loop, in the order it first reaches them
+	Cells []Pos
+}
+
+// The states the guard goes round forever, or nil if it walks off the map
+func (p Patrol) Cycle() []GuardState {
+	if !p.IsLoop {
+		return nil
+	}
+
+	return p.Path[p.LoopStart:]
+}
+
+// Walks the guard one step at a time from the start with an obstacle at pos, and describes the loop it gets stuck in.
+// Returns false if it doesn't get stuck, which means the obstacle doesn't cause a loop after all.
+func (g *Grid) loopReport(obstacle Pos) (LoopReport, bool) {
+	patrol := g.Simulate(g.GuardStart, &obstacle)
+
+	if !patrol.IsLoop {
+		return LoopReport{}, false
+	}
+
+	cycle := patrol.Cycle()
+	report := LoopReport{Obstacle: obstacle, EntryStep: patrol.LoopStart, Length: len(cycle)}
+	seen := make(map[Pos]bool)
+
+	for _, state := range cycle {
+		if !seen[state.Pos] {
+			seen[state.Pos] = true
+			report.Cells = append(report.Cells, state.Pos)
+		}
+	}
+
+	return report, true
+}
+
+// Describes the loop each obstacle causes. Part 2 finds the obstacles by jumping between obstacles,
+// whereas this walks the guard one step at a time, so any obstacle where the two disagree is returned
+// separately (there shouldn't be any).
+func loopReports(grid *Grid, obstacles []Pos, workers int) ([]LoopReport, []Pos) {
+	reports := make([]LoopReport, len(obstacles))
+	isLoop := make([]bool, len(obstacles))
+
+	forEachIndex(len(obstacles), workers, func(i int) {
+		reports[i], isLoop[i] = grid.loopReport(obstacles[i])
+	})
+
+	loops := make([]LoopReport, 0, len(obstacles))
+	mismatches := make([]Pos, 0)
+
+	for i, obstacle := range obstacles {
+		if isLoop[i] {
+			loops = append(loops, reports[i])
+		} else {
+			mismatches = append(mismatches, obstacle)
+		}
+	}
+
+	return loops, mismatches
+}
+
+func (r LoopReport) Print(w io.Writer) {
+	cells := make([]string, 0, len(r.Cells))
+
+	for _, cell := range r.Cells {
+		cells = append(cells, fmt.Sprintf("%d,%d", cell.Row, cell.Col))
+	}
+
+	fmt.Fprintf(w, "obstacle %d,%d: enters the loop at step %d, loop is %d steps through %d cells: %v\n",
+		r.Obstacle.Row, r.Obstacle.Col, r.EntryStep, r.Length, len(r.Cells), strings.Join(cells, " "))
+}
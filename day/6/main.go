@@ -2,81 +2,128 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 func main() {
-	text, err := io.ReadAll(os.Stdin)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "path":
+			runPathCommand(os.Args[2:])
+			return
+		case "replay":
+			runReplayCommand(os.Args[2:])
+			return
+		case "trap":
+			runTrapCommand(os.Args[2:])
+			return
+		}
+	}
+
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines to simulate part 2's obstacles with")
+	showLoops := flag.Bool("loops", false, "describe the loop each of part 2's obstacles traps the guard in")
+	getRules := addRuleFlags(flag.CommandLine)
+	flag.Parse()
+
+	rules, err := getRules()
+
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	reader := bytes.NewReader(text)
-
-	grid := buildGrid(reader)
-	part1Total := totalForGridPart1(grid)
+	grid, err := readGrid(os.Stdin, rules)
 
-	_, err = reader.Seek(0, io.SeekStart)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	if len(grid.GuardStarts) > 1 {
+		printGroupPatrol(grid)
+		return
+	}
+
+	part1Total, patrol := totalForGridPart1(grid)
+
+	visitedOverlay := make(map[Pos]string)
+
+	for _, pos := range patrol.Visited {
+		visitedOverlay[pos] = "X"
+	}
+
 	fmt.Println("")
 	fmt.Println("Part 1 grid:")
-	grid.Print(false)
+	grid.Print(visitedOverlay)
 	fmt.Println("")
 
 	fmt.Println("")
 	fmt.Println("Total (Part 1):")
 	fmt.Println(part1Total)
 
-	part2Total := totalForGridPart2(grid)
+	part2Total, loopObstacles := totalForGridPart2(grid, patrol, *workers)
+
+	candidatesOverlay := map[Pos]string{grid.GuardStart.Pos: grid.GuardStart.Dir.Glyph()}
+
+	for _, pos := range loopObstacles {
+		candidatesOverlay[pos] = "0"
+	}
 
 	fmt.Println("")
 	fmt.Println("Part 2 grid:")
-	grid.Reset()
-	grid.Print(true)
+	grid.Print(candidatesOverlay)
 	fmt.Println("")
 
 	fmt.Println("")
 	fmt.Println("Total (Part 2):")
 	fmt.Println(part2Total)
-}
 
-var directions []string = []string{"N", "NE", "E", "SE", "S", "SW", "W", "NW"}
+	if *showLoops {
+		loops, mismatches := loopReports(grid, loopObstacles, *workers)
 
-type Grid struct {
-	FirstNode           *GridNode
-	GuardNode           *GridNode
-	GuardStartingNode   *GridNode
-	ObstacleAttemptNode *GridNode
-	VisitedNodes        []*GridNode
-	Done                bool
+		fmt.Println("")
+		fmt.Println("Loops (Part 2):")
+
+		for _, loop := range loops {
+			loop.Print(os.Stdout)
+		}
+
+		for _, pos := range mismatches {
+			fmt.Printf("WARNING: obstacle %d,%d was counted as a loop, but the guard walks off the map\n", pos.Row, pos.Col)
+		}
+	}
 }
 
-func (g *Grid) Reset() {
-	for _, gn := range g.VisitedNodes {
-		// Reset everything except for "IsObstacleCandidate"
-		gn.Value = "."
-		gn.VisitCount = 0
-		gn.HasGuardFacedNorth = false
-		gn.HasGuardFacedEast = false
-		gn.HasGuardFacedSouth = false
-		gn.HasGuardFacedWest = false
-		gn.IsGuardInLoop = false
+func readGrid(r io.Reader, rules Rules) (*Grid, error) {
+	text, err := io.ReadAll(r)
+
+	if err != nil {
+		return nil, err
 	}
 
-	g.GuardNode = g.GuardStartingNode
-	g.GuardNode.Value = "^"
-	g.GuardNode.VisitCount = 1
-	g.GuardNode.HasGuardFacedNorth = true
-	g.GuardNode.HasGuardFacedEast = false
-	g.GuardNode.HasGuardFacedSouth = false
-	g.GuardNode.HasGuardFacedWest = false
-	g.GuardNode.IsGuardInLoop = false
+	return buildGrid(bytes.NewReader(text), rules)
+}
+
+// The map, which never changes once it's built. The guard's state is kept separately (see GuardState).
+type Grid struct {
+	FirstNode *GridNode
+	// Where the guard starts, and which way it's facing. If there's more than one guard, this is the first.
+	GuardStart GuardState
+	// Every guard, in reading order
+	GuardStarts []GuardState
+	Rules       Rules
+	Width       int
+	Height      int
+	// The same nodes as the linked grid, indexed by row then column
+	nodes [][]*GridNode
+	// Where the guard stops walking from each cell in each direction (see buildJumpTable)
+	jumps [][][4]jump
 }
 
 func (g *Grid) First() (*GridNode, bool) {
@@ -87,105 +134,43 @@ func (g *Grid) First() (*GridNode, bool) {
 	return &GridNode{}, false
 }
 
-func (g *Grid) Guard() (*GridNode, bool) {
-	if g.GuardNode != nil {
-		return g.GuardNode, true
+func (g *Grid) At(pos Pos) (*GridNode, bool) {
+	if pos.Row < 0 || pos.Row >= g.Height || pos.Col < 0 || pos.Col >= g.Width {
+		return &GridNode{}, false
 	}
 
-	return &GridNode{}, false
+	return g.nodes[pos.Row][pos.Col], true
 }
 
 type GridNode struct {
-	NorthNode           *GridNode
-	EastNode            *GridNode
-	SouthNode           *GridNode
-	WestNode            *GridNode
-	Value               string
-	VisitCount          int
-	HasGuardFacedNorth  bool
-	HasGuardFacedEast   bool
-	HasGuardFacedSouth  bool
-	HasGuardFacedWest   bool
-	IsGuardInLoop       bool
-	IsObstacleCandidate bool
+	NorthNode *GridNode
+	EastNode  *GridNode
+	SouthNode *GridNode
+	WestNode  *GridNode
+	Row       int
+	Col       int
+	// The glyph from the map (or the first floor glyph where a guard starts)
+	Value      string
+	isObstacle bool
 }
 
-func (gn *GridNode) WalkGuard() (*GridNode, bool) {
-	if !gn.IsGuardNode() {
-		fmt.Fprintf(os.Stderr, "WalkGuard() called on non-guard node")
-		os.Exit(1)
-	}
-
-	var newNode *GridNode
-	var guardNode *GridNode
-	var isInGrid bool
-
-	switch gn.Value {
-	case "^":
-		newNode, isInGrid = gn.N()
-	case ">":
-		newNode, isInGrid = gn.E()
-	case "v":
-		newNode, isInGrid = gn.S()
-	case "<":
-		newNode, isInGrid = gn.W()
-	}
-
-	if !isInGrid {
-		// Guard exited the grid!
-		gn.Value = "X"
-		return newNode, false
-	}
-
-	if newNode.IsObstacle() {
-		// Rotate the guard
-		switch gn.Value {
-		case "^":
-			gn.Value = ">"
-		case ">":
-			gn.Value = "v"
-		case "v":
-			gn.Value = "<"
-		case "<":
-			gn.Value = "^"
-		}
+func (gn *GridNode) Pos() Pos {
+	return Pos{Row: gn.Row, Col: gn.Col}
+}
 
-		guardNode = gn
-	} else {
-		newNode.Value = gn.Value
-		gn.Value = "X"
-		newNode.VisitCount++
-		guardNode = newNode
+func (gn *GridNode) Neighbour(dir Direction) (*GridNode, bool) {
+	switch dir {
+	case North:
+		return gn.N()
+	case East:
+		return gn.E()
+	case South:
+		return gn.S()
+	case West:
+		return gn.W()
 	}
 
-	switch guardNode.Value {
-	case "^":
-		if guardNode.HasGuardFacedNorth {
-			guardNode.IsGuardInLoop = true
-		} else {
-			guardNode.HasGuardFacedNorth = true
-		}
-	case ">":
-		if guardNode.HasGuardFacedEast {
-			guardNode.IsGuardInLoop = true
-		} else {
-			guardNode.HasGuardFacedEast = true
-		}
-	case "v":
-		if guardNode.HasGuardFacedSouth {
-			guardNode.IsGuardInLoop = true
-		} else {
-			guardNode.HasGuardFacedSouth = true
-		}
-	case "<":
-		if guardNode.HasGuardFacedWest {
-			guardNode.IsGuardInLoop = true
-		} else {
-			guardNode.HasGuardFacedWest = true
-		}
-	}
-
-	return guardNode, true
+	return &GridNode{}, false
 }
 
 func (gn *GridNode) N() (*GridNode, bool) {
@@ -252,26 +237,24 @@ func (gn *GridNode) NW() (*GridNode, bool) {
 	return &GridNode{}, false
 }
 
-func (gn *GridNode) IsGuardNode() bool {
-	switch gn.Value {
-	case "^", ">", "v", "<":
-		return true
-	default:
-		return false
-	}
-}
-
 func (gn *GridNode) IsObstacle() bool {
-	return gn.Value == "#" || gn.Value == "0"
+	return gn.isObstacle
 }
 
-func buildGrid(reader *bytes.Reader) *Grid {
-	grid := Grid{Done: false}
+func buildGrid(reader *bytes.Reader, rules Rules) (*Grid, error) {
+	grid := Grid{Rules: rules}
+	firstFloorGlyph, _ := utf8.DecodeRuneInString(rules.FloorGlyphs)
 	var current *GridNode
 	var currentLineFirst *GridNode
 
 	i := 0
 	j := 0
+	blankLines := 0
+
+	// Skip a leading byte order mark, which some Windows editors add
+	if r, _, err := reader.ReadRune(); err == nil && r != byteOrderMark {
+		_ = reader.UnreadRune()
+	}
 
 	// Build the grid left to right, top to bottom
 	for {
@@ -280,34 +263,58 @@ func buildGrid(reader *bytes.Reader) *Grid {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			fmt.Fprintf(os.Stderr, "Error reading standard input\n")
-			os.Exit(1)
+			return nil, fmt.Errorf("error reading input: %w", err)
 		}
 
 		if isLineTerminator(r) {
+			if r == '\r' {
+				// Treat "\r\n" (Windows line endings) as a single line terminator
+				if next, _, err := reader.ReadRune(); err == nil && next != '\n' {
+					_ = reader.UnreadRune()
+				}
+			}
+
+			if i == 0 {
+				// Blank lines are only allowed at the end of the input
+				blankLines++
+				continue
+			}
+
+			err := grid.endRow(j, i)
+
+			if err != nil {
+				return nil, err
+			}
+
 			// Start a new line
 			i = 0
 			j++
 			continue
 		}
 
+		if blankLines > 0 {
+			return nil, fmt.Errorf("row %d is blank", j+1)
+		}
+
 		char := string(r)
 		var newNode GridNode
 
 		if i == 0 {
+			grid.nodes = append(grid.nodes, []*GridNode{})
+
 			if j == 0 {
-				newNode = GridNode{Value: char}
+				newNode = GridNode{Value: char, Row: j, Col: i}
 				current = &newNode
 				grid.FirstNode = current
 			} else {
-				newNode = GridNode{Value: char, NorthNode: currentLineFirst}
+				newNode = GridNode{Value: char, Row: j, Col: i, NorthNode: currentLineFirst}
 				current = &newNode
 				currentLineFirst.SouthNode = current
 			}
 
 			currentLineFirst = current
 		} else {
-			newNode = GridNode{Value: char, WestNode: current}
+			newNode = GridNode{Value: char, Row: j, Col: i, WestNode: current}
 
 			north, ok := current.NE()
 
@@ -322,117 +329,137 @@ func buildGrid(reader *bytes.Reader) *Grid {
 			current = &newNode
 		}
 
-		if newNode.IsGuardNode() {
-			newNode.VisitCount = 1
-			// NOTE: ...assuming the guard can only start facing north!!!
-			newNode.HasGuardFacedNorth = true
-			grid.GuardStartingNode = &newNode
-			grid.GuardNode = &newNode
+		if dir, ok := directionForGlyph(char); ok {
+			// The guard isn't part of the map, it's just standing on open floor
+			newNode.Value = string(firstFloorGlyph)
+			grid.GuardStarts = append(grid.GuardStarts, GuardState{Pos: Pos{Row: j, Col: i}, Dir: dir})
+		} else if strings.ContainsRune(rules.ObstacleGlyphs, r) {
+			newNode.isObstacle = true
+		} else if !strings.ContainsRune(rules.FloorGlyphs, r) {
+			return nil, fmt.Errorf("row %d, column %d is %q, which isn't an obstacle, open floor or a guard", j+1, i+1, char)
 		}
 
+		grid.nodes[j] = append(grid.nodes[j], &newNode)
+
 		i++
 	}
 
-	return &grid
-}
-
-func totalForGridPart1(grid *Grid) int {
-	// The current guard node has already been visited,
-	// so we start at 1
-	total := 1
+	if i > 0 {
+		// The last line didn't have a line terminator
+		err := grid.endRow(j, i)
 
-	for {
-		guardNode, ok := grid.Guard()
-
-		if !ok {
-			fmt.Fprintf(os.Stderr, "grid does not seem to have a guard node")
-			os.Exit(1)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		if !guardNode.IsGuardNode() {
-			fmt.Fprintf(os.Stderr, "grid.GuardNode is not a valid guard node")
-			os.Exit(1)
-		}
+	if len(grid.GuardStarts) == 0 {
+		return nil, fmt.Errorf("the map doesn't have a guard (^, >, v or <)")
+	}
 
-		newGuardNode, ok := guardNode.WalkGuard()
+	grid.GuardStart = grid.GuardStarts[0]
 
-		// Guard changed nodes (or left the grid)
-		if newGuardNode != guardNode {
-			grid.GuardNode = newGuardNode
+	grid.buildJumpTable()
 
-			if newGuardNode.VisitCount == 1 {
-				grid.VisitedNodes = append(grid.VisitedNodes, newGuardNode)
-				total++
-			}
-		}
+	return &grid, nil
+}
 
-		if !ok {
-			// Guard left the grid
-			grid.Done = true
-			break
-		}
+// Records the width of the first row, and checks that every other row matches it
+func (g *Grid) endRow(row int, width int) error {
+	if row == 0 {
+		g.Width = width
+	} else if width != g.Width {
+		return fmt.Errorf("row %d has %d cells, but row 1 has %d", row+1, width, g.Width)
 	}
 
-	return total
+	g.Height = row + 1
+
+	return nil
 }
 
-func totalForGridPart2(grid *Grid) int {
-	total := 0
+func totalForGridPart1(grid *Grid) (int, Patrol) {
+	patrol := grid.Simulate(grid.GuardStart, nil)
 
-	nodesToAttempt := make([]*GridNode, len(grid.VisitedNodes))
-	copy(nodesToAttempt, grid.VisitedNodes)
+	return len(patrol.Visited), patrol
+}
 
-	for _, gn := range nodesToAttempt {
-		grid.Reset()
-		gn.Value = "0"
+// Where part 2 could put an obstacle: every cell the guard visits in part 1, except where it starts
+// (the guard is standing there). An obstacle anywhere else would never be reached, so can't change anything.
+//
+// The guard's path is the same as in part 1 until it first reaches the obstacle,
+// so each trial starts from the state just before that, rather than from the beginning.
+// NOTE: that's the *first* visit; the guard may cross the cell again later, but by then
+// its path would already have been changed by the obstacle.
+func obstacleCandidates(grid *Grid, patrol Patrol) ([]Pos, []GuardState) {
+	candidates := make([]Pos, 0, len(patrol.Visited))
+	trialStarts := make([]GuardState, 0, len(patrol.Visited))
+
+	for i, pos := range patrol.Visited {
+		if pos == grid.GuardStart.Pos {
+			continue
+		}
 
-		for {
-			guardNode, ok := grid.Guard()
+		candidates = append(candidates, pos)
+		trialStarts = append(trialStarts, patrol.Path[patrol.FirstVisits[i]-1])
+	}
 
-			if !ok {
-				fmt.Fprintf(os.Stderr, "grid does not seem to have a guard node")
-				os.Exit(1)
-			}
+	return candidates, trialStarts
+}
 
-			if !ok {
-				fmt.Fprintf(os.Stderr, "grid does not seem to have a guard node")
-				os.Exit(1)
-			}
+// Calls fn with each index from 0 to n-1, spread across a pool of workers, and waits for them all.
+// fn runs concurrently, so it mustn't change anything shared. If it only reads shared state
+// and writes its result at index i, the results are the same for any number of workers.
+func forEachIndex(n int, workers int, fn func(i int)) {
+	indexes := make(chan int)
 
-			if !guardNode.IsGuardNode() {
-				fmt.Fprintf(os.Stderr, "grid.GuardNode is not a valid guard node")
-				os.Exit(1)
-			}
+	var wg sync.WaitGroup
 
-			newGuardNode, ok := guardNode.WalkGuard()
+	for range max(workers, 1) {
+		wg.Add(1)
 
-			// Guard changed nodes (or left the grid)
-			if newGuardNode != guardNode {
-				grid.GuardNode = newGuardNode
+		go func() {
+			defer wg.Done()
 
-				if newGuardNode.VisitCount == 1 {
-					grid.VisitedNodes = append(grid.VisitedNodes, newGuardNode)
-				}
+			for i := range indexes {
+				fn(i)
 			}
+		}()
+	}
 
-			if newGuardNode.IsGuardInLoop {
-				gn.IsObstacleCandidate = true
+	for i := range n {
+		indexes <- i
+	}
 
-				total++
-				break
-			}
+	close(indexes)
+	wg.Wait()
+}
 
-			if !ok {
-				// Guard left the grid
-				grid.Done = true
-				break
-			}
+// Tries an obstacle on each candidate cell (see obstacleCandidates),
+// and returns how many of them trap the guard in a loop, and where they are.
+//
+// Each trial is simulated independently (see forEachIndex). Simulations don't change the grid
+// or the candidates, so the answer is the same for any number of workers.
+func totalForGridPart2(grid *Grid, patrol Patrol, workers int) (int, []Pos) {
+	candidates, trialStarts := obstacleCandidates(grid, patrol)
+	causesLoop := make([]bool, len(candidates))
+
+	forEachIndex(len(candidates), workers, func(i int) {
+		causesLoop[i] = grid.IsLoop(trialStarts[i], &candidates[i])
+	})
+
+	loopObstacles := make([]Pos, 0)
+
+	for i, pos := range candidates {
+		if causesLoop[i] {
+			loopObstacles = append(loopObstacles, pos)
 		}
 	}
 
-	return total
+	return len(loopObstacles), loopObstacles
 }
 
+const byteOrderMark = '\uFEFF'
+
 func isLineTerminator(r rune) bool {
 	switch r {
 	case '\u000a', '\u000d', '\u2028', '\u2029':
@@ -442,7 +469,8 @@ func isLineTerminator(r rune) bool {
 }
 
 // debugging util
-func (g *Grid) Print(showObstacleCandidates bool) {
+// Prints the map, with any cells in overlay replaced by their glyph (e.g. "X" for visited cells)
+func (g *Grid) Print(overlay map[Pos]string) {
 	first, ok := g.First()
 
 	if !ok {
@@ -453,8 +481,8 @@ func (g *Grid) Print(showObstacleCandidates bool) {
 	current, currentLineFirst := first, first
 
 	for {
-		if showObstacleCandidates && current.IsObstacleCandidate {
-			fmt.Print("0")
+		if glyph, ok := overlay[current.Pos()]; ok {
+			fmt.Print(glyph)
 		} else {
 			fmt.Print(current.Value)
 		}
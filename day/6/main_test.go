@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func gridForFile(t testing.TB, name string, rules Rules) *Grid {
+	t.Helper()
+
+	file, err := os.Open(name)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	grid, err := readGrid(file, rules)
+
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+
+	return grid
+}
+
+// Part 2 shares the grid and the part 1 patrol between workers, so run this with -race
+func TestTotalForGridPart2Workers(t *testing.T) {
+	tests := []struct {
+		file string
+		want int
+	}{
+		{"test1.txt", 6},
+		{"test2.txt", 2},
+		{"input.txt", 1729},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			grid := gridForFile(t, test.file, DefaultRules)
+			_, patrol := totalForGridPart1(grid)
+
+			sequentialTotal, sequentialObstacles := totalForGridPart2(grid, patrol, 1)
+
+			if sequentialTotal != test.want {
+				t.Errorf("1 worker: got %d, want %d", sequentialTotal, test.want)
+			}
+
+			for _, workers := range []int{2, 8} {
+				total, obstacles := totalForGridPart2(grid, patrol, workers)
+
+				if total != sequentialTotal || !slices.Equal(obstacles, sequentialObstacles) {
+					t.Errorf("%d workers: got %d (%v), want %d (%v)", workers, total, obstacles, sequentialTotal, sequentialObstacles)
+				}
+			}
+		})
+	}
+}
+
+func TestTotals(t *testing.T) {
+	tests := []struct {
+		file string
+		// Whether the guard walks back through the cell it starts on, where part 2 can't put an obstacle
+		crossesStart bool
+		part1        int
+		part2        int
+	}{
+		{"test1.txt", true, 41, 6},
+		// The guard walks back through its starting cell. An obstacle there would trap it too,
+		// so counting the starting cell would give 3.
+		{"test2.txt", true, 5, 2},
+		// The guard walks straight off the map, so there's nowhere to put an obstacle
+		{"test3.txt", false, 1, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			grid := gridForFile(t, test.file, DefaultRules)
+			part1, patrol := totalForGridPart1(grid)
+
+			if part1 != test.part1 {
+				t.Errorf("part 1: got %d, want %d", part1, test.part1)
+			}
+
+			crossesStart := slices.ContainsFunc(patrol.Path[1:], func(state GuardState) bool {
+				return state.Pos == grid.GuardStart.Pos
+			})
+
+			if crossesStart != test.crossesStart {
+				t.Errorf("crosses start: got %v, want %v", crossesStart, test.crossesStart)
+			}
+
+			candidates, _ := obstacleCandidates(grid, patrol)
+
+			if slices.Contains(candidates, grid.GuardStart.Pos) {
+				t.Errorf("the guard's starting cell %v is an obstacle candidate", grid.GuardStart.Pos)
+			}
+
+			part2, _ := totalForGridPart2(grid, patrol, 1)
+
+			if part2 != test.part2 {
+				t.Errorf("part 2: got %d, want %d", part2, test.part2)
+			}
+		})
+	}
+}
+
+func TestBuildGrid(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// The map's rows (with the guard replaced by floor) and where the guard starts, if it builds
+		want      []string
+		wantGuard GuardState
+		// Part of the error, if it doesn't
+		wantErr string
+	}{
+		{"line feeds", "#.\n.^\n", []string{"#.", ".."}, GuardState{Pos{1, 1}, North}, ""},
+		{"no final line terminator", "#.\n.^", []string{"#.", ".."}, GuardState{Pos{1, 1}, North}, ""},
+		{"windows line endings", "#.\r\n.^\r\n", []string{"#.", ".."}, GuardState{Pos{1, 1}, North}, ""},
+		// The byte order mark isn't a cell, so the guard is still in the first column
+		{"byte order mark", "\ufeff>#\n..\n", []string{".#", ".."}, GuardState{Pos{0, 0}, East}, ""},
+		{"trailing blank lines", "#.\n.^\n\n\r\n", []string{"#.", ".."}, GuardState{Pos{1, 1}, North}, ""},
+		{"blank line between rows", "#.\n\n.^\n", nil, GuardState{}, "row 2 is blank"},
+		{"blank line between windows rows", "#.\r\n\r\n.^\r\n", nil, GuardState{}, "row 2 is blank"},
+		{"short row", "#..\n.^\n...\n", nil, GuardState{}, "row 2 has 2 cells, but row 1 has 3"},
+		{"long row", "#.\n.^\n...\n", nil, GuardState{}, "row 3 has 3 cells, but row 1 has 2"},
+		{"short last row", "#.\n^", nil, GuardState{}, "row 2 has 1 cells, but row 1 has 2"},
+		{"no guard", "#.\n..\n", nil, GuardState{}, "doesn't have a guard"},
+		{"unknown glyph", "#.\n.^\n.x\n", nil, GuardState{}, "row 3, column 2 is \"x\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grid, err := buildGrid(bytes.NewReader([]byte(test.text)), DefaultRules)
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if grid.Width != len(test.want[0]) || grid.Height != len(test.want) {
+				t.Fatalf("got %dx%d, want %dx%d", grid.Width, grid.Height, len(test.want[0]), len(test.want))
+			}
+
+			got := make([]string, 0, grid.Height)
+
+			for row := range grid.Height {
+				text := ""
+
+				for col := range grid.Width {
+					node, _ := grid.At(Pos{Row: row, Col: col})
+					text += node.Value
+				}
+
+				got = append(got, text)
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("got rows %q, want %q", got, test.want)
+			}
+
+			if grid.GuardStart != test.wantGuard {
+				t.Errorf("got guard %v, want %v", grid.GuardStart, test.wantGuard)
+			}
+		})
+	}
+}
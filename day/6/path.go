@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One state in an exported patrol
+type PathStep struct {
+	Step    int    `json:"step"`
+	Row     int    `json:"row"`
+	Col     int    `json:"col"`
+	Heading string `json:"heading"`
+	// What happened at this step, if anything: "start", "turn", "exit" (the guard walks off the map
+	// from here) or "loop" (the guard comes back to this state, and repeats from here forever)
+	Events []string `json:"events,omitempty"`
+}
+
+// A patrol, in the form it's exported in
+type PathExport struct {
+	// The obstacle added to the map, if any
+	Obstacle *Pos `json:"obstacle"`
+	// "exit" or "loop"
+	Outcome string     `json:"outcome"`
+	Steps   []PathStep `json:"steps"`
+	// The step where the guard exits the map, or enters its loop
+	EndStep int `json:"endStep"`
+}
+
+func (p Patrol) Export(obstacle *Pos) PathExport {
+	export := PathExport{Obstacle: obstacle, Outcome: "exit", Steps: make([]PathStep, 0, len(p.Path))}
+
+	for i, state := range p.Path {
+		step := PathStep{Step: i, Row: state.Pos.Row, Col: state.Pos.Col, Heading: state.Dir.String()}
+
+		if i == 0 {
+			step.Events = append(step.Events, "start")
+		} else if state.Pos == p.Path[i-1].Pos {
+			// The guard turned on the spot, rather than stepping forwards
+			step.Events = append(step.Events, "turn")
+		}
+
+		export.Steps = append(export.Steps, step)
+	}
+
+	if p.IsLoop {
+		export.Outcome = "loop"
+		export.EndStep = p.LoopStart
+	} else {
+		export.EndStep = len(p.Path) - 1
+	}
+
+	export.Steps[export.EndStep].Events = append(export.Steps[export.EndStep].Events, export.Outcome)
+
+	return export
+}
+
+// Writes the path as "json" or "csv" (one row per step, with any events separated by ";")
+func (e PathExport) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(e)
+	case "csv":
+		writer := csv.NewWriter(w)
+
+		_ = writer.Write([]string{"step", "row", "col", "heading", "events"})
+
+		for _, step := range e.Steps {
+			_ = writer.Write([]string{
+				strconv.Itoa(step.Step),
+				strconv.Itoa(step.Row),
+				strconv.Itoa(step.Col),
+				step.Heading,
+				strings.Join(step.Events, ";"),
+			})
+		}
+
+		writer.Flush()
+
+		return writer.Error()
+	}
+
+	return fmt.Errorf("unknown path format %q (expected json or csv)", format)
+}
+
+// Parses an obstacle position, given as "row,col" (counting from 0), and checks it can go on the map
+func (g *Grid) parseObstacle(s string) (*Pos, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	rowText, colText, ok := strings.Cut(s, ",")
+
+	if !ok {
+		return nil, fmt.Errorf("invalid obstacle %q (expected row,col)", s)
+	}
+
+	row, err := strconv.Atoi(strings.TrimSpace(rowText))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid obstacle row %q: %w", rowText, err)
+	}
+
+	col, err := strconv.Atoi(strings.TrimSpace(colText))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid obstacle column %q: %w", colText, err)
+	}
+
+	pos := Pos{Row: row, Col: col}
+	node, ok := g.At(pos)
+
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("obstacle %d,%d is off the map", row, col)
+	case node.IsObstacle():
+		return nil, fmt.Errorf("there's already an obstacle at %d,%d", row, col)
+	case slices.ContainsFunc(g.GuardStarts, func(start GuardState) bool { return start.Pos == pos }):
+		return nil, fmt.Errorf("the guard is standing at %d,%d", row, col)
+	}
+
+	return &pos, nil
+}
+
+// Reads the map from stdin, and walks the guard with the -obstacle flag's obstacle (if any).
+// If there's more than one guard, only the first is walked.
+func simulateForFlags(obstacleFlag string, getRules func() (Rules, error)) (*Grid, *Pos, Patrol) {
+	rules, err := getRules()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	grid, err := readGrid(os.Stdin, rules)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	obstacle, err := grid.parseObstacle(obstacleFlag)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return grid, obstacle, grid.Simulate(grid.GuardStart, obstacle)
+}
+
+// daysix path [-format json|csv] [-obstacle row,col] < input.txt
+func runPathCommand(args []string) {
+	flags := flag.NewFlagSet("path", flag.ExitOnError)
+	format := flags.String("format", "json", "path format: json or csv")
+	obstacleFlag := flags.String("obstacle", "", "add an obstacle at row,col (counting from 0) before walking the guard")
+	getRules := addRuleFlags(flags)
+
+	flags.Parse(args)
+
+	_, obstacle, patrol := simulateForFlags(*obstacleFlag, getRules)
+
+	err := patrol.Export(obstacle).Write(os.Stdout, *format)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// daysix replay [-obstacle row,col] [-delay 100ms] < input.txt
+func runReplayCommand(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	obstacleFlag := flags.String("obstacle", "", "add an obstacle at row,col (counting from 0) before walking the guard")
+	delay := flags.Duration("delay", 100*time.Millisecond, "how long to show each step for")
+	getRules := addRuleFlags(flags)
+
+	flags.Parse(args)
+
+	grid, obstacle, patrol := simulateForFlags(*obstacleFlag, getRules)
+	overlay := make(map[Pos]string)
+
+	for i, state := range patrol.Path {
+		if i > 0 {
+			overlay[patrol.Path[i-1].Pos] = "X"
+		}
+
+		overlay[state.Pos] = state.Dir.Glyph()
+
+		if obstacle != nil {
+			overlay[*obstacle] = "O"
+		}
+
+		// Move the cursor to the top left and clear the screen, so each step is drawn over the last
+		fmt.Print("\x1b[H\x1b[2J")
+		fmt.Printf("Step %d of %d (%d,%d, facing %v)\n\n", i, len(patrol.Path)-1, state.Pos.Row, state.Pos.Col, state.Dir)
+		grid.Print(overlay)
+
+		time.Sleep(*delay)
+	}
+
+	end := patrol.Path[len(patrol.Path)-1]
+
+	if patrol.IsLoop {
+		loopStart := patrol.Path[patrol.LoopStart]
+		fmt.Printf("The guard is back at step %d (%d,%d, facing %v), and will loop forever\n", patrol.LoopStart, loopStart.Pos.Row, loopStart.Pos.Col, loopStart.Dir)
+	} else {
+		fmt.Printf("The guard walks off the map from %d,%d, facing %v\n", end.Pos.Row, end.Pos.Col, end.Dir)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Which way the guard turns when there's an obstacle in the way
+type Turn string
+
+const (
+	TurnRight  Turn = "right"
+	TurnLeft   Turn = "left"
+	TurnAround Turn = "u-turn"
+)
+
+func parseTurn(s string) (Turn, error) {
+	switch turn := Turn(s); turn {
+	case TurnRight, TurnLeft, TurnAround:
+		return turn, nil
+	}
+
+	return "", fmt.Errorf("unknown turn %q (expected right, left or u-turn)", s)
+}
+
+// The direction the guard faces after turning from d
+func (t Turn) From(d Direction) Direction {
+	switch t {
+	case TurnLeft:
+		return d.TurnLeft()
+	case TurnAround:
+		return d.Reverse()
+	default:
+		return d.TurnRight()
+	}
+}
+
+// What happens when guards on the same map run into each other
+// (both step into the same cell, or swap cells)
+type CollisionPolicy string
+
+const (
+	// Guards walk through each other
+	PassThrough CollisionPolicy = "pass"
+	// Guards treat each other as obstacles, and turn instead of colliding
+	BlockEachOther CollisionPolicy = "block"
+	// Guards that collide stop where they are, and take no further part
+	StopOnCollision CollisionPolicy = "stop"
+)
+
+func parseCollisionPolicy(s string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(s); policy {
+	case PassThrough, BlockEachOther, StopOnCollision:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("unknown collision policy %q (expected pass, block or stop)", s)
+}
+
+// How the guards move, and how the map is drawn
+type Rules struct {
+	Turn Turn
+	// Every glyph that's an obstacle
+	ObstacleGlyphs string
+	// Every glyph that's open floor
+	FloorGlyphs string
+	// Only matters when there's more than one guard
+	Collisions CollisionPolicy
+}
+
+// The rules from the puzzle
+var DefaultRules = Rules{Turn: TurnRight, ObstacleGlyphs: "#", FloorGlyphs: ".", Collisions: PassThrough}
+
+func (r Rules) Validate() error {
+	if r.ObstacleGlyphs == "" || r.FloorGlyphs == "" {
+		return fmt.Errorf("there must be at least one obstacle glyph and one floor glyph")
+	}
+
+	for _, glyph := range r.ObstacleGlyphs + r.FloorGlyphs {
+		if _, ok := directionForGlyph(string(glyph)); ok {
+			return fmt.Errorf("%q is a guard, so it can't be an obstacle or floor glyph", glyph)
+		}
+	}
+
+	if i := strings.IndexAny(r.ObstacleGlyphs, r.FloorGlyphs); i != -1 {
+		// i is a byte offset, and the glyph might take more than one byte
+		glyph, _ := utf8.DecodeRuneInString(r.ObstacleGlyphs[i:])
+
+		return fmt.Errorf("%q can't be both an obstacle and floor glyph", glyph)
+	}
+
+	return nil
+}
+
+// Registers flags for each rule on flags. The returned function gets the rules once the flags are parsed.
+func addRuleFlags(flags *flag.FlagSet) func() (Rules, error) {
+	turn := flags.String("turn", string(DefaultRules.Turn), "which way the guard turns at an obstacle: right, left or u-turn")
+	obstacles := flags.String("obstacles", DefaultRules.ObstacleGlyphs, "glyphs that are obstacles")
+	floor := flags.String("floor", DefaultRules.FloorGlyphs, "glyphs that are open floor")
+	collisions := flags.String("collisions", string(DefaultRules.Collisions), "what happens when guards run into each other: pass, block or stop")
+
+	return func() (Rules, error) {
+		rules := Rules{ObstacleGlyphs: *obstacles, FloorGlyphs: *floor}
+
+		var err error
+
+		rules.Turn, err = parseTurn(*turn)
+
+		if err != nil {
+			return Rules{}, err
+		}
+
+		rules.Collisions, err = parseCollisionPolicy(*collisions)
+
+		if err != nil {
+			return Rules{}, err
+		}
+
+		return rules, rules.Validate()
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+)
+
+// The result of searching for the fewest obstacles that trap the guard in a loop
+type TrapSearch struct {
+	// The obstacles that trap the guard, or nil if none were found
+	Obstacles []Pos
+	// How many simulations were run
+	Simulations int
+	// Whether the search ran out of simulations before it finished.
+	// If so, no trap needs fewer obstacles than Depth, but one with more might still exist.
+	OutOfBudget bool
+	// How many obstacles were being tried when the search stopped
+	Depth int
+}
+
+// A set of obstacles that doesn't trap the guard, and where the guard goes with them
+type trapCandidate struct {
+	Obstacles []Pos
+	Visited   []Pos
+}
+
+// Walks the guard with obstacles added on top of the ones on the map
+func (g *Grid) simulateWithObstacles(obstacles []Pos) Patrol {
+	return g.simulateWith(g.GuardStart, func(node *GridNode) bool {
+		return node.IsObstacle() || slices.Contains(obstacles, node.Pos())
+	})
+}
+
+// Searches for the fewest added obstacles (up to maxObstacles) that trap the guard in a loop,
+// running at most budget simulations.
+//
+// This is a breadth-first search, so the first trap it finds has as few obstacles as possible:
+// each set of obstacles that doesn't trap the guard is extended by one obstacle on each cell
+// the guard then visits (like part 2, an obstacle anywhere else wouldn't change anything).
+func (g *Grid) findTrap(maxObstacles int, budget int) TrapSearch {
+	search := TrapSearch{}
+	// Sets of obstacles that have been tried already, in any order
+	tried := map[string]bool{"": true}
+
+	if budget < 1 {
+		// Not even enough to walk the guard once
+		search.OutOfBudget = true
+		return search
+	}
+
+	frontier := []trapCandidate{{Visited: g.simulateWithObstacles(nil).Visited}}
+	search.Simulations++
+
+	for depth := 1; depth <= maxObstacles && len(frontier) > 0; depth++ {
+		search.Depth = depth
+		nextFrontier := make([]trapCandidate, 0)
+
+		for _, current := range frontier {
+			obstacles := current.Obstacles
+
+			// The guard only goes where it went with these obstacles, so that's where the next one could go
+			for _, pos := range current.Visited {
+				if pos == g.GuardStart.Pos || slices.Contains(obstacles, pos) {
+					continue
+				}
+
+				candidate := append(slices.Clone(obstacles), pos)
+				key := obstacleSetKey(candidate)
+
+				if tried[key] {
+					continue
+				}
+
+				tried[key] = true
+
+				if search.Simulations >= budget {
+					search.OutOfBudget = true
+					return search
+				}
+
+				search.Simulations++
+				patrol := g.simulateWithObstacles(candidate)
+
+				if patrol.IsLoop {
+					search.Obstacles = candidate
+					return search
+				}
+
+				if depth < maxObstacles {
+					nextFrontier = append(nextFrontier, trapCandidate{Obstacles: candidate, Visited: patrol.Visited})
+				}
+			}
+		}
+
+		frontier = nextFrontier
+	}
+
+	return search
+}
+
+// The same key for a set of obstacles whatever order they're in
+func obstacleSetKey(obstacles []Pos) string {
+	sorted := slices.SortedFunc(slices.Values(obstacles), func(a, b Pos) int {
+		if a.Row != b.Row {
+			return a.Row - b.Row
+		}
+
+		return a.Col - b.Col
+	})
+
+	return formatPositions(sorted)
+}
+
+// For a map where the guard already loops, the obstacles it walks into whose removal lets it walk off the map,
+// in the order it first walks into them. The guard doesn't walk into any other obstacles, so removing them
+// wouldn't change anything.
+func (g *Grid) findEscapes(patrol Patrol) []Pos {
+	escapes := make([]Pos, 0)
+	tried := make(map[Pos]bool)
+
+	for _, state := range patrol.Path {
+		obstaclePos := state.Pos.Step(state.Dir)
+		node, ok := g.At(obstaclePos)
+
+		if !ok || !node.IsObstacle() || tried[obstaclePos] {
+			continue
+		}
+
+		tried[obstaclePos] = true
+
+		withoutObstacle := g.simulateWith(g.GuardStart, func(node *GridNode) bool {
+			return node.IsObstacle() && node.Pos() != obstaclePos
+		})
+
+		if !withoutObstacle.IsLoop {
+			escapes = append(escapes, obstaclePos)
+		}
+	}
+
+	return escapes
+}
+
+func formatPositions(positions []Pos) string {
+	formatted := make([]string, 0, len(positions))
+
+	for _, pos := range positions {
+		formatted = append(formatted, fmt.Sprintf("%d,%d", pos.Row, pos.Col))
+	}
+
+	return strings.Join(formatted, " ")
+}
+
+// daysix trap [-max 3] [-budget 100000] < input.txt
+//
+// If the guard walks off the map, finds the fewest obstacles that trap it in a loop.
+// If it's already stuck in a loop, finds the obstacles that could be removed to let it escape.
+// If there's more than one guard, only the first is considered.
+func runTrapCommand(args []string) {
+	flags := flag.NewFlagSet("trap", flag.ExitOnError)
+	maxObstacles := flags.Int("max", 3, "the most obstacles to try adding")
+	budget := flags.Int("budget", 100000, "the most simulations to run while searching")
+	getRules := addRuleFlags(flags)
+
+	flags.Parse(args)
+
+	rules, err := getRules()
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	grid, err := readGrid(os.Stdin, rules)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	patrol := grid.Simulate(grid.GuardStart, nil)
+
+	if patrol.IsLoop {
+		escapes := grid.findEscapes(patrol)
+
+		if len(escapes) == 0 {
+			fmt.Println("The guard is already stuck in a loop, and removing any one obstacle doesn't let it escape")
+		} else {
+			fmt.Printf("The guard is already stuck in a loop, removing any one of these %d obstacles lets it escape: %v\n", len(escapes), formatPositions(escapes))
+		}
+
+		return
+	}
+
+	search := grid.findTrap(*maxObstacles, *budget)
+
+	switch {
+	case search.Obstacles != nil:
+		if len(search.Obstacles) == 1 {
+			fmt.Printf("Trapping the guard takes 1 obstacle: %v (found after %d simulations)\n", formatPositions(search.Obstacles), search.Simulations)
+		} else {
+			fmt.Printf("Trapping the guard takes %d obstacles: %v (found after %d simulations)\n", len(search.Obstacles), formatPositions(search.Obstacles), search.Simulations)
+		}
+	case search.OutOfBudget && search.Depth == 0:
+		fmt.Println("The budget isn't enough to walk the guard even once")
+	case search.OutOfBudget:
+		fmt.Printf("Ran out of budget after %d simulations: trapping the guard takes at least %d obstacles\n", search.Simulations, search.Depth)
+	default:
+		fmt.Printf("There's no way to trap the guard with up to %d obstacles (tried %d simulations)\n", *maxObstacles, search.Simulations)
+	}
+}